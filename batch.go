@@ -0,0 +1,150 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchCall is a call within a batch. Result and Error are set once the
+// batch has been sent and answered.
+type BatchCall struct {
+	Method string
+	Params []any
+	Result any
+	Error  error
+	call   *PendingCall
+	// index is the position of the call in the batch
+	index int
+}
+
+// Batch collects calls and notifications which are sent together in one frame.
+type Batch struct {
+	protocol *Protocol
+	msgs     []*RpcMessage
+	calls    []*BatchCall
+}
+
+// NewBatch creates an empty batch sent through the protocol.
+func (p *Protocol) NewBatch() *Batch {
+	return &Batch{
+		protocol: p,
+	}
+}
+
+// Call adds a call to the batch.
+func (b *Batch) Call(method string, params []any) *BatchCall {
+	msg := MakeCall(NumberId(b.protocol.nextSeq()), method, params)
+	call := &BatchCall{
+		Method: method,
+		Params: params,
+		call:   NewPendingCall(msg),
+		index:  len(b.msgs),
+	}
+	b.msgs = append(b.msgs, msg)
+	b.calls = append(b.calls, call)
+	return call
+}
+
+// Notify adds a notification to the batch.
+func (b *Batch) Notify(method string, params []any) {
+	b.msgs = append(b.msgs, MakeNotify(method, params))
+}
+
+// Len returns the number of messages in the batch.
+func (b *Batch) Len() int {
+	return len(b.msgs)
+}
+
+// Send sends the batch and blocks until all calls are answered.
+// The outcome of each call is recorded on its BatchCall.
+func (b *Batch) Send() error {
+	return b.SendContext(context.Background())
+}
+
+// SendContext sends the batch and blocks until all calls are answered
+// or the context is done. Each call runs through the outbound middlewares
+// of the protocol, calls a middleware answers itself are left out of the
+// batch.
+func (b *Batch) SendContext(ctx context.Context) error {
+	if len(b.msgs) == 0 {
+		return nil
+	}
+	p := b.protocol
+	p.mutex.Lock()
+	middlewares := p.middlewares
+	p.mutex.Unlock()
+	// the calls reaching the end of the chain wait there until the batch
+	// is sent, the others report nil
+	ready := make(chan *BatchCall)
+	sent := make(chan struct{})
+	var err error
+	var wg sync.WaitGroup
+	for _, c := range b.calls {
+		c := c
+		reached := false
+		handler := chain(func(ctx context.Context, msg *RpcMessage) (any, error) {
+			if reached {
+				// retries are sent on their own
+				return p.roundTrip(ctx, msg)
+			}
+			reached = true
+			c.call = NewPendingCall(msg)
+			ready <- c
+			<-sent
+			if err != nil {
+				return nil, err
+			}
+			return p.wait(ctx, c.call)
+		}, middlewares)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Result, c.Error = handler(ctx, c.call.Message)
+			if !reached {
+				ready <- nil
+			}
+		}()
+	}
+	frame := make([]*RpcMessage, len(b.msgs))
+	copy(frame, b.msgs)
+	for _, c := range b.calls {
+		frame[c.index] = nil
+	}
+	var calls []*PendingCall
+	for range b.calls {
+		if c := <-ready; c != nil {
+			calls = append(calls, c.call)
+			frame[c.index] = c.call.Message
+		}
+	}
+	err = p.sendBatch(ctx, frame, calls)
+	close(sent)
+	wg.Wait()
+	return err
+}
+
+// sendBatch sends the messages of the frame which are not nil and
+// registers the calls among them.
+func (p *Protocol) sendBatch(ctx context.Context, frame []*RpcMessage, calls []*PendingCall) error {
+	msgs := make([]*RpcMessage, 0, len(frame))
+	for _, msg := range frame {
+		if msg != nil {
+			msgs = append(msgs, msg)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	err := p.addPending(calls...)
+	if err != nil {
+		return err
+	}
+	err = p.sendBatchContext(ctx, msgs)
+	if err != nil {
+		for _, c := range calls {
+			p.takePending(c.Message.Id)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Bridge relays the messages of websocket clients to backends speaking
+// over another transport, e.g. processes talking over stdio. Each client
+// gets a backend of its own unless the backend is shared. A shared backend
+// sees the calls of all clients with ids rewritten to be unique, its
+// notifications go to all clients and its calls to the oldest client. The
+// shared backend is closed when its last client leaves and started again
+// for the next one.
+type Bridge struct {
+	hub     *Hub
+	backend func() (Transport, error)
+	shared  bool
+	mutex   sync.Mutex
+	mux     *bridgeMux
+}
+
+// NewBridge creates a bridge upgrading requests with the hub and starting
+// backends with the backend function.
+func NewBridge(hub *Hub, backend func() (Transport, error), shared bool) *Bridge {
+	return &Bridge{
+		hub:     hub,
+		backend: backend,
+		shared:  shared,
+	}
+}
+
+// HandleRequest upgrades the request to a websocket and relays it.
+func (b *Bridge) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	client, err := b.hub.Upgrade(w, r)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if !b.shared {
+		backend, err := b.backend()
+		if err != nil {
+			log.Printf("error: %v", err)
+			client.Close()
+			return
+		}
+		go relay(client, backend)
+		go relay(backend, client)
+		return
+	}
+	err = b.serveShared(client)
+	if err != nil {
+		log.Printf("error: %v", err)
+		client.Close()
+	}
+}
+
+// serveShared relays the client to the shared backend, starting it if it
+// is not running.
+func (b *Bridge) serveShared(t Transport) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	c := &bridgeClient{Transport: t}
+	if b.mux == nil || !b.mux.add(c) {
+		backend, err := b.backend()
+		if err != nil {
+			return err
+		}
+		b.mux = &bridgeMux{
+			backend: backend,
+			routes:  make(map[uint64]bridgeRoute),
+		}
+		go b.mux.readBackend()
+		b.mux.add(c)
+	}
+	go b.mux.readClient(c)
+	return nil
+}
+
+// relay copies messages from src to dst until either fails and then
+// closes both.
+func relay(src, dst Transport) {
+	defer func() {
+		src.Close()
+		dst.Close()
+	}()
+	for {
+		data, err := src.ReadMessage()
+		if err != nil {
+			return
+		}
+		err = dst.WriteMessage(data)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// bridgeClient serializes the messages written to a client.
+type bridgeClient struct {
+	Transport
+	mutex sync.Mutex
+}
+
+func (c *bridgeClient) send(data []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err := c.WriteMessage(data)
+	if err != nil {
+		log.Printf("bridge: dropping message to client: %v", err)
+	}
+}
+
+// bridgeRoute leads a reply of the backend to the client which made the call.
+type bridgeRoute struct {
+	client *bridgeClient
+	id     json.RawMessage
+}
+
+// bridgeMux shares one backend among clients.
+type bridgeMux struct {
+	backend Transport
+	// writeMutex serializes the writes of the clients to the backend
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	seq        uint64
+	routes     map[uint64]bridgeRoute
+	clients    []*bridgeClient
+	closed     bool
+}
+
+// add adds the client unless the backend is closed.
+func (m *bridgeMux) add(c *bridgeClient) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return false
+	}
+	m.clients = append(m.clients, c)
+	return true
+}
+
+// readClient relays the messages of the client to the backend.
+func (m *bridgeMux) readClient(c *bridgeClient) {
+	defer func() {
+		m.remove(c)
+		c.Close()
+	}()
+	for {
+		data, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if !json.Valid(data) {
+			reply, _ := json.Marshal(MakeError(ErrorCodeParse, "Parse error", nil))
+			c.send(reply)
+			continue
+		}
+		err = m.write(m.rewrite(c, data))
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (m *bridgeMux) write(data []byte) error {
+	m.writeMutex.Lock()
+	defer m.writeMutex.Unlock()
+	return m.backend.WriteMessage(data)
+}
+
+// rewrite gives the calls of the client ids unique to the backend.
+func (m *bridgeMux) rewrite(c *bridgeClient, data []byte) []byte {
+	if !isBatch(data) {
+		return m.rewriteMessage(c, data)
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return data
+	}
+	for i, entry := range entries {
+		entries[i] = m.rewriteMessage(c, entry)
+	}
+	out, err := json.Marshal(entries)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+func (m *bridgeMux) rewriteMessage(c *bridgeClient, data []byte) []byte {
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return data
+	}
+	id, hasId := msg["id"]
+	var method string
+	if _, isRequest := msg["method"]; !isRequest || json.Unmarshal(msg["method"], &method) != nil {
+		// replies to calls of the backend keep their ids
+		return data
+	}
+	if method == CancelRequestMethod {
+		m.rewriteCancel(c, msg)
+	}
+	if hasId {
+		m.mutex.Lock()
+		m.seq++
+		seq := m.seq
+		m.routes[seq] = bridgeRoute{client: c, id: id}
+		m.mutex.Unlock()
+		msg["id"] = json.RawMessage(strconv.FormatUint(seq, 10))
+	}
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// rewriteCancel replaces the id in the params of a cancel request.
+func (m *bridgeMux) rewriteCancel(c *bridgeClient, msg map[string]json.RawMessage) {
+	var named map[string]json.RawMessage
+	var positional []json.RawMessage
+	var id json.RawMessage
+	if json.Unmarshal(msg["params"], &named) == nil {
+		id = named["id"]
+	} else if json.Unmarshal(msg["params"], &positional) == nil && len(positional) > 0 {
+		id = positional[0]
+	}
+	seq, ok := m.lookupRoute(c, id)
+	if !ok {
+		return
+	}
+	id = json.RawMessage(strconv.FormatUint(seq, 10))
+	var params []byte
+	if named != nil {
+		named["id"] = id
+		params, _ = json.Marshal(named)
+	} else {
+		positional[0] = id
+		params, _ = json.Marshal(positional)
+	}
+	msg["params"] = params
+}
+
+func (m *bridgeMux) lookupRoute(c *bridgeClient, id json.RawMessage) (uint64, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for seq, route := range m.routes {
+		if route.client == c && bytes.Equal(route.id, id) {
+			return seq, true
+		}
+	}
+	return 0, false
+}
+
+// remove removes the client and its routes, closing the backend when it
+// was the last client.
+func (m *bridgeMux) remove(c *bridgeClient) {
+	m.mutex.Lock()
+	for i, client := range m.clients {
+		if client == c {
+			m.clients = append(m.clients[:i], m.clients[i+1:]...)
+			break
+		}
+	}
+	for seq, route := range m.routes {
+		if route.client == c {
+			delete(m.routes, seq)
+		}
+	}
+	// new clients start another backend once this one is closing
+	last := len(m.clients) == 0 && !m.closed
+	if last {
+		m.closed = true
+	}
+	m.mutex.Unlock()
+	if last {
+		m.backend.Close()
+	}
+}
+
+// readBackend routes the messages of the backend to the clients. When the
+// backend stops, all clients are closed.
+func (m *bridgeMux) readBackend() {
+	defer m.close()
+	for {
+		data, err := m.backend.ReadMessage()
+		if err != nil {
+			return
+		}
+		m.route(data)
+	}
+}
+
+func (m *bridgeMux) route(data []byte) {
+	if !isBatch(data) {
+		out, clients := m.routeMessage(data)
+		for _, c := range clients {
+			c.send(out)
+		}
+		return
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return
+	}
+	var order []*bridgeClient
+	batches := make(map[*bridgeClient][]json.RawMessage)
+	for _, entry := range entries {
+		out, clients := m.routeMessage(entry)
+		for _, c := range clients {
+			if _, ok := batches[c]; !ok {
+				order = append(order, c)
+			}
+			batches[c] = append(batches[c], out)
+		}
+	}
+	for _, c := range order {
+		out, err := json.Marshal(batches[c])
+		if err == nil {
+			c.send(out)
+		}
+	}
+}
+
+// routeMessage returns the message as the clients receiving it expect it.
+func (m *bridgeMux) routeMessage(data []byte) ([]byte, []*bridgeClient) {
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, isRequest := msg["method"]; isRequest {
+		if _, hasId := msg["id"]; !hasId {
+			return data, append([]*bridgeClient(nil), m.clients...)
+		}
+		if len(m.clients) == 0 {
+			return nil, nil
+		}
+		return data, m.clients[:1:1]
+	}
+	seq, err := strconv.ParseUint(string(msg["id"]), 10, 64)
+	route, ok := m.routes[seq]
+	if err != nil || !ok {
+		log.Printf("bridge: dropping reply %s", data)
+		return nil, nil
+	}
+	delete(m.routes, seq)
+	msg["id"] = route.id
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return nil, nil
+	}
+	return out, []*bridgeClient{route.client}
+}
+
+func (m *bridgeMux) close() {
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return
+	}
+	m.closed = true
+	clients := m.clients
+	m.clients = nil
+	m.mutex.Unlock()
+	for _, c := range clients {
+		c.Close()
+	}
+	m.backend.Close()
+}
@@ -0,0 +1,201 @@
+package jsonrpc
+
+import (
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTestBridge serves a bridge to in-memory backends answering "whoami"
+// with the number of the backend.
+func makeTestBridge(shared bool) *httptest.Server {
+	var started int64
+	backend := func() (Transport, error) {
+		a, b := NewPipe()
+		n := atomic.AddInt64(&started, 1)
+		server := NewTransportClient(b)
+		server.RegisterMethod("whoami", func(params []any) (any, error) {
+			return n, nil
+		})
+		return a, nil
+	}
+	bridge := NewBridge(NewHub(), backend, shared)
+	handler := NewRouter()
+	handler.Get("/ws", bridge.HandleRequest)
+	return httptest.NewServer(handler)
+}
+
+func TestBridge(t *testing.T) {
+	ts := makeTestBridge(false)
+	defer ts.Close()
+	a, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+	defer a.Close()
+	b, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+	defer b.Close()
+	first, err := a.Call("whoami", nil)
+	assert.NoError(t, err)
+	second, err := b.Call("whoami", nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestSharedBridge(t *testing.T) {
+	a2, b2 := NewPipe()
+	backend := NewTransportClient(b2)
+	backend.RegisterMethod("echo", func(params []any) (any, error) {
+		time.Sleep(10 * time.Millisecond)
+		return params[0], nil
+	})
+	started := 0
+	bridge := NewBridge(NewHub(), func() (Transport, error) {
+		started++
+		return a2, nil
+	}, true)
+	handler := NewRouter()
+	handler.Get("/ws", bridge.HandleRequest)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	clients := make([]*RpcClient, 3)
+	events := make(chan bool, len(clients))
+	for i := range clients {
+		client, err := makeTestClient(HttpToWsAddr(ts.URL))
+		assert.NoError(t, err)
+		defer client.Close()
+		client.RegisterMethod("event", func(params []any) (any, error) {
+			events <- true
+			return nil, nil
+		})
+		clients[i] = client
+	}
+	// all clients use the same ids at the same time
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client *RpcClient) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				result, err := client.Call("echo", []any{i*10 + j})
+				assert.NoError(t, err)
+				assert.Equal(t, float64(i*10+j), result)
+			}
+		}(i, client)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, started)
+
+	// backend notifications reach every client
+	assert.NoError(t, backend.Notify("event", nil))
+	for range clients {
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Fatal("notification not relayed")
+		}
+	}
+
+	// backend calls go to the oldest client
+	clients[0].RegisterMethod("ask", func(params []any) (any, error) {
+		return "first", nil
+	})
+	result, err := backend.Call("ask", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", result)
+
+	// a batch is split by client
+	batch := clients[1].Batch()
+	x := batch.Call("echo", []any{"x"})
+	y := batch.Call("echo", []any{"y"})
+	assert.NoError(t, batch.Send())
+	assert.Equal(t, "x", x.Result)
+	assert.Equal(t, "y", y.Result)
+}
+
+func TestSharedBridgeRestart(t *testing.T) {
+	ts := makeTestBridge(true)
+	defer ts.Close()
+	a, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+	first, err := a.Call("whoami", nil)
+	assert.NoError(t, err)
+	a.Close()
+
+	// the backend left with its last client, the next client starts another
+	assert.Eventually(t, func() bool {
+		b, err := makeTestClient(HttpToWsAddr(ts.URL))
+		if err != nil {
+			return false
+		}
+		defer b.Close()
+		second, err := b.Call("whoami", nil)
+		return err == nil && second != first
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// exclusiveTransport fails writes which overlap another write.
+type exclusiveTransport struct {
+	Transport
+	writing int32
+	overlap int32
+}
+
+func (t *exclusiveTransport) WriteMessage(data []byte) error {
+	if !atomic.CompareAndSwapInt32(&t.writing, 0, 1) {
+		atomic.StoreInt32(&t.overlap, 1)
+		return errors.New("concurrent write")
+	}
+	defer atomic.StoreInt32(&t.writing, 0)
+	time.Sleep(time.Millisecond)
+	return t.Transport.WriteMessage(data)
+}
+
+func TestSharedBridgeWrites(t *testing.T) {
+	a, b := NewPipe()
+	backend := NewTransportClient(b)
+	defer backend.Close()
+	backend.RegisterMethod("echo", func(params []any) (any, error) {
+		return params[0], nil
+	})
+	exclusive := &exclusiveTransport{Transport: a}
+	bridge := NewBridge(NewHub(), func() (Transport, error) {
+		return exclusive, nil
+	}, true)
+	handler := NewRouter()
+	handler.Get("/ws", bridge.HandleRequest)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		client, err := makeTestClient(HttpToWsAddr(ts.URL))
+		assert.NoError(t, err)
+		defer client.Close()
+		wg.Add(1)
+		go func(client *RpcClient) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := client.Call("echo", []any{j})
+				assert.NoError(t, err)
+			}
+		}(client)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&exclusive.overlap))
+}
+
+func TestBridgeMuxLastClient(t *testing.T) {
+	a, _ := NewPipe()
+	m := &bridgeMux{backend: a, routes: make(map[uint64]bridgeRoute)}
+	c := &bridgeClient{}
+	assert.True(t, m.add(c))
+	m.remove(c)
+	// a client joining now gets a new backend
+	assert.False(t, m.add(&bridgeClient{}))
+}
@@ -1,45 +1,44 @@
 package jsonrpc
 
 import (
-	"time"
+	"context"
 
 	"github.com/gorilla/websocket"
 )
 
-const (
-	// Time allowed to write a message to the peer.
-	writeWait = 10 * time.Second
-	// Max message size allowed from peer.
-	maxMessageSize = 512
-	// Time allowed to read the next pong message from the peer.
-	pongWait = 60 * time.Second
-	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
-)
-
 type RpcClient struct {
 	Conn *Connection
-	// Methods *Methods
-	Methods
+	*Methods
+}
+
+func NewRpcClient(conn *websocket.Conn, opts ...ConnectionOptions) *RpcClient {
+	return NewCodecClient(conn, JSONCodec, opts...)
+}
+
+// NewCodecClient creates a client encoding messages with the codec.
+func NewCodecClient(conn *websocket.Conn, codec Codec, opts ...ConnectionOptions) *RpcClient {
+	methods := NewRegistry()
+	return &RpcClient{
+		Conn:    NewCodecConnection(conn, codec, methods, nil, opts...),
+		Methods: methods,
+	}
+}
+
+// NewTransportClient creates a client talking over the transport.
+func NewTransportClient(t Transport) *RpcClient {
+	return newClient(t, NewRegistry())
 }
 
-func NewRpcClient(conn *websocket.Conn) *RpcClient {
-	c := &RpcClient{
-		Conn: nil,
-		// Methods: NewRegistry(),
-		Methods: Methods{
-			methods: make(map[string]MethodHandle),
-		},
+// newClient creates a client serving the methods over the transport.
+func newClient(t Transport, methods *Methods) *RpcClient {
+	return &RpcClient{
+		Conn:    NewTransportConnection(t, methods, nil),
+		Methods: methods,
 	}
-	c.Conn = NewConnection(conn, &c.Methods, nil)
-	// go c.readPump()
-	// go c.writePump()
-	return c
 }
 
 // Close closes the connection
 func (c *RpcClient) Close() {
-	c.Conn.conn.WriteControl(websocket.CloseMessage, []byte{}, time.Now().Add(writeWait))
 	c.Conn.Close()
 }
 
@@ -48,11 +47,32 @@ func (c *RpcClient) Call(method string, params []any) (any, error) {
 	return c.Conn.SendCall(method, params)
 }
 
+// CallContext sends a request to the server and waits for a response until
+// the context is done.
+func (c *RpcClient) CallContext(ctx context.Context, method string, params []any) (any, error) {
+	return c.Conn.CallContext(ctx, method, params)
+}
+
+// CallNamed sends a request with params passed by name and waits for a response.
+// Params is a map or a struct which encodes to a JSON object.
+func (c *RpcClient) CallNamed(method string, params any) (any, error) {
+	named, err := toNamedParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return c.Conn.SendNamedCall(method, named)
+}
+
 // Notify sends a notification to the server.
 func (c *RpcClient) Notify(method string, params []any) error {
 	return c.Conn.SendMessage(MakeNotify(method, params))
 }
 
+// Batch creates a batch of calls and notifications sent in one frame.
+func (c *RpcClient) Batch() *Batch {
+	return c.Conn.NewBatch()
+}
+
 // Error sends an error message to the server.
 func (c *RpcClient) Error(code ErrorCode, message string, data interface{}) error {
 	return c.Conn.SendMessage(MakeError(code, message, data))
@@ -0,0 +1,52 @@
+// Command jsonrpc-bridge makes a JSON-RPC tool speaking over stdio, e.g. a
+// language server, reachable over websockets. Each websocket client gets a
+// process of its own, unless -shared is set.
+//
+//	jsonrpc-bridge -addr :8080 -path /ws -- my-language-server --stdio
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/apigear-io/jsonrpc"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	path := flag.String("path", "/ws", "websocket path")
+	shared := flag.Bool("shared", false, "share one process among all clients")
+	framing := flag.String("framing", "header", "stdio framing, header (Content-Length) or line")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] command [args...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var transport func(rwc io.ReadWriteCloser) jsonrpc.Transport
+	switch *framing {
+	case "header":
+		transport = jsonrpc.NewFramedTransport
+	case "line":
+		transport = jsonrpc.NewLineTransport
+	default:
+		log.Fatalf("unknown framing %q", *framing)
+	}
+	backend := func() (jsonrpc.Transport, error) {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = os.Stderr
+		return jsonrpc.NewProcessTransport(cmd, transport)
+	}
+	bridge := jsonrpc.NewBridge(jsonrpc.NewHub(), backend, *shared)
+	server := jsonrpc.NewHTTPServer()
+	server.Router().Get(*path, bridge.HandleRequest)
+	log.Fatal(server.Start(*addr))
+}
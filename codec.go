@@ -0,0 +1,197 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes the messages of a connection. Messages are handled as JSON,
+// other codecs translate at the edge of the connection. Struct values are
+// encoded by their json tags with every codec.
+type Codec interface {
+	// Name identifies the codec, e.g. "json".
+	Name() string
+	// Binary reports whether the encoded messages are binary data.
+	Binary() bool
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSONCodec encodes messages as JSON text, the default.
+	JSONCodec Codec = jsonCodec{}
+	// MsgpackCodec encodes messages as MessagePack.
+	MsgpackCodec Codec = msgpackCodec{}
+	// CBORCodec encodes messages as CBOR.
+	CBORCodec Codec = newCBORCodec()
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Binary() bool {
+	return false
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) Binary() bool {
+	return true
+}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	err := enc.Encode(toWire(v))
+	return buf.Bytes(), err
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+type cborCodec struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+func newCBORCodec() cborCodec {
+	enc, err := cbor.EncOptions{}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	dec, err := cbor.DecOptions{
+		DefaultMapType: reflect.TypeOf(map[string]any{}),
+	}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return cborCodec{enc: enc, dec: dec}
+}
+
+func (cborCodec) Name() string {
+	return "cbor"
+}
+
+func (cborCodec) Binary() bool {
+	return true
+}
+
+func (c cborCodec) Marshal(v any) ([]byte, error) {
+	return c.enc.Marshal(toWire(v))
+}
+
+func (c cborCodec) Unmarshal(data []byte, v any) error {
+	return c.dec.Unmarshal(data, v)
+}
+
+// toWire lays out messages and batches as JSON-RPC objects for codecs
+// which do not know about json.Marshaler.
+func toWire(v any) any {
+	switch v := v.(type) {
+	case *RpcMessage:
+		return v.wire()
+	case []*RpcMessage:
+		batch := make([]any, len(v))
+		for i, msg := range v {
+			batch[i] = msg.wire()
+		}
+		return batch
+	}
+	return v
+}
+
+// wire lays out the message like MarshalJSON.
+func (r *RpcMessage) wire() map[string]any {
+	w := map[string]any{"jsonrpc": r.Version}
+	if r.Version == "" {
+		w["jsonrpc"] = ProtocolVersion
+	}
+	if !r.Id.IsZero() || r.Method == "" {
+		w["id"] = r.Id.wire()
+	}
+	if r.Method != "" {
+		w["method"] = r.Method
+		if r.NamedParams != nil {
+			w["params"] = r.NamedParams
+		} else if len(r.Params) > 0 {
+			w["params"] = r.Params
+		}
+	} else if r.Error != nil {
+		e := map[string]any{"code": r.Error.Code, "message": r.Error.Message}
+		if r.Error.Data != nil {
+			e["data"] = r.Error.Data
+		}
+		w["error"] = e
+	} else {
+		w["result"] = r.Result
+	}
+	return w
+}
+
+// wire returns the id as number, string or nil.
+func (id Id) wire() any {
+	switch id.kind {
+	case idNumber:
+		if n, err := strconv.ParseUint(id.value, 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseInt(id.value, 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(id.value, 64); err == nil {
+			return f
+		}
+	case idString:
+		return id.value
+	}
+	return nil
+}
+
+// encode encodes a message or batch with the codec.
+func encode(codec Codec, v any) ([]byte, error) {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return codec.Marshal(v)
+}
+
+// toJSON translates a message or batch encoded with the codec to JSON.
+// The extra decode and encode make reading binary messages slower than
+// reading JSON (see BenchmarkDecode), in exchange all codecs share the
+// JSON path which validates messages and batches.
+func toJSON(codec Codec, data []byte) ([]byte, error) {
+	if codec == nil || codec == JSONCodec {
+		return data, nil
+	}
+	var v any
+	err := codec.Unmarshal(data, &v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,183 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	msgs := []*RpcMessage{
+		MakeCall(NumberId(1), "add", []any{1, 2.5, "x"}),
+		MakeNamedCall(StringId("a"), "greet", map[string]any{"name": "bob"}),
+		MakeNotify("event", nil),
+		MakeResult(NumberId(7), map[string]any{"ok": true}),
+		makeErrorReply(NullId(), ErrorCodeParse, "Parse error"),
+		{Version: ProtocolVersion, Id: NumberId(2), Error: &RpcError{Code: -32000, Message: "failed", Data: []any{"detail"}}},
+	}
+	for _, codec := range []Codec{JSONCodec, MsgpackCodec, CBORCodec} {
+		for _, msg := range msgs {
+			data, err := codec.Marshal(msg)
+			assert.NoError(t, err)
+			data, err = toJSON(codec, data)
+			assert.NoError(t, err)
+			expected, err := msg.MarshalJSON()
+			assert.NoError(t, err)
+			assert.JSONEq(t, string(expected), string(data), codec.Name())
+		}
+		data, err := codec.Marshal(msgs[:2])
+		assert.NoError(t, err)
+		data, err = toJSON(codec, data)
+		assert.NoError(t, err)
+		assert.True(t, isBatch(data), codec.Name())
+	}
+}
+
+type point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+func testCodecConnection(t *testing.T, codec Codec) {
+	hub, ts := makeTestHub()
+	hub.SetCodec(codec)
+	client, err := DialWebSocket(HttpToWsAddr(ts.URL), ConnectionOptions{}, codec)
+	assert.NoError(t, err)
+	defer func() {
+		hub.RemoveAllConnections()
+		client.Close()
+		ts.Close()
+	}()
+	err = hub.Register("norm", func(ctx context.Context, p point) (int, error) {
+		if p.X < 0 {
+			return 0, ErrInvalidParams
+		}
+		return p.X*p.X + p.Y*p.Y, nil
+	})
+	assert.NoError(t, err)
+
+	result, err := client.Call("norm", []any{point{3, 4}})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(25), result)
+	_, err = client.Call("norm", []any{point{-1, 0}})
+	assert.True(t, errors.Is(err, ErrInvalidParams))
+	assert.Equal(t, codec, client.Conn.Codec())
+}
+
+func TestMsgpackConnection(t *testing.T) {
+	testCodecConnection(t, MsgpackCodec)
+}
+
+func TestCBORConnection(t *testing.T) {
+	testCodecConnection(t, CBORCodec)
+}
+
+func TestBinaryFrames(t *testing.T) {
+	hub, ts := makeTestHub()
+	hub.SetCodec(MsgpackCodec)
+	defer ts.Close()
+	hub.RegisterMethod("ping", func(params []any) (any, error) {
+		return "pong", nil
+	})
+	ws, err := dialWebSocket(HttpToWsAddr(ts.URL), []string{subprotocol(MsgpackCodec)}, ConnectionOptions{}.withDefaults())
+	assert.NoError(t, err)
+	defer ws.Close()
+
+	data, err := MsgpackCodec.Marshal(MakeCall(NumberId(1), "ping", nil))
+	assert.NoError(t, err)
+	assert.NoError(t, ws.WriteMessage(websocket.BinaryMessage, data))
+	kind, data, err := ws.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.BinaryMessage, kind)
+	reply, err := toJSON(MsgpackCodec, data)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"pong"}`, string(reply))
+
+	// frames the codec cannot decode are parse errors
+	assert.NoError(t, ws.WriteMessage(websocket.BinaryMessage, []byte{0xc1}))
+	_, data, err = ws.ReadMessage()
+	assert.NoError(t, err)
+	reply, err = toJSON(MsgpackCodec, data)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"Parse error"}}`, string(reply))
+}
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	hub, ts := makeTestHub()
+	hub.SetCodecs(MsgpackCodec, JSONCodec)
+	defer func() {
+		hub.RemoveAllConnections()
+		ts.Close()
+	}()
+	hub.RegisterMethod("codec", func(params []any) (any, error) {
+		return "ok", nil
+	})
+	url := HttpToWsAddr(ts.URL)
+
+	// the hub prefers msgpack
+	client, err := DialWebSocket(url, ConnectionOptions{})
+	assert.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, MsgpackCodec, client.Conn.Codec())
+	result, err := client.Call("codec", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", result)
+
+	client, err = DialWebSocket(url, ConnectionOptions{}, JSONCodec)
+	assert.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, JSONCodec, client.Conn.Codec())
+	result, err = client.Call("codec", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", result)
+
+	// clients sharing no subprotocol are rejected
+	_, err = DialWebSocket(url, ConnectionOptions{}, CBORCodec)
+	assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+
+	// clients requesting none speak JSON
+	ws, err := NewWebSocket(url)
+	assert.NoError(t, err)
+	client = NewRpcClient(ws)
+	defer client.Close()
+	result, err = client.Call("codec", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", result)
+}
+
+// BenchmarkDecode compares translating incoming messages to JSON, as the
+// connection does, with decoding them only, the floor of decoding them
+// directly into messages.
+func BenchmarkDecode(b *testing.B) {
+	msg := MakeCall(NumberId(1), "echo", makeDocument(10))
+	for _, codec := range []Codec{JSONCodec, MsgpackCodec, CBORCodec} {
+		data, err := codec.Marshal(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(codec.Name()+"/translate", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				out, err := toJSON(codec, data)
+				if err != nil {
+					b.Fatal(err)
+				}
+				var m RpcMessage
+				if err := json.Unmarshal(out, &m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(codec.Name()+"/decode", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var v any
+				if err := codec.Unmarshal(data, &v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
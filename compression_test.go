@@ -0,0 +1,129 @@
+package jsonrpc
+
+import (
+	"compress/flate"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingConn counts the bytes written to the network.
+type countingConn struct {
+	net.Conn
+	written *int64
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	atomic.AddInt64(c.written, int64(len(p)))
+	return c.Conn.Write(p)
+}
+
+// dialCounting dials a client counting the bytes it writes.
+func dialCounting(url string, opts ConnectionOptions, written *int64) (*RpcClient, error) {
+	dialer := websocket.Dialer{
+		EnableCompression: opts.Compression,
+		NetDial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			return countingConn{conn, written}, err
+		},
+	}
+	ws, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewRpcClient(ws, opts), nil
+}
+
+// makeDocument returns a large repetitive document like typical payloads.
+func makeDocument(items int) []any {
+	doc := make([]any, items)
+	for i := range doc {
+		doc[i] = map[string]any{
+			"id":          i,
+			"name":        fmt.Sprintf("sensor-%d", i),
+			"description": "temperature sensor in the north wing of the building",
+			"unit":        "celsius",
+			"enabled":     true,
+		}
+	}
+	return doc
+}
+
+func TestCompression(t *testing.T) {
+	hub, ts := makeTestHubWithOptions(HubOptions{ConnectionOptions{Compression: true}})
+	defer func() {
+		hub.RemoveAllConnections()
+		ts.Close()
+	}()
+	hub.RegisterMethod("echo", func(params []any) (any, error) {
+		return len(params), nil
+	})
+	doc := makeDocument(100)
+	payload, err := MakeCall(NumberId(1), "echo", doc).MarshalJSON()
+	assert.NoError(t, err)
+
+	var written int64
+	client, err := dialCounting(HttpToWsAddr(ts.URL), ConnectionOptions{Compression: true}, &written)
+	assert.NoError(t, err)
+	defer client.Close()
+	start := atomic.LoadInt64(&written)
+	_, err = client.Call("echo", doc)
+	assert.NoError(t, err)
+	assert.Less(t, atomic.LoadInt64(&written)-start, int64(len(payload)/4))
+
+	// messages below the threshold are sent uncompressed
+	client, err = dialCounting(HttpToWsAddr(ts.URL), ConnectionOptions{Compression: true, CompressionThreshold: 1 << 20}, &written)
+	assert.NoError(t, err)
+	defer client.Close()
+	start = atomic.LoadInt64(&written)
+	_, err = client.Call("echo", doc)
+	assert.NoError(t, err)
+	assert.Greater(t, atomic.LoadInt64(&written)-start, int64(len(payload)))
+}
+
+func BenchmarkCompression(b *testing.B) {
+	cases := []struct {
+		name string
+		opts ConnectionOptions
+	}{
+		{"off", ConnectionOptions{}},
+		{"speed", ConnectionOptions{Compression: true, CompressionLevel: flate.BestSpeed}},
+		{"default", ConnectionOptions{Compression: true, CompressionLevel: flate.DefaultCompression}},
+		{"best", ConnectionOptions{Compression: true, CompressionLevel: flate.BestCompression}},
+	}
+	for _, items := range []int{1, 10, 100} {
+		doc := makeDocument(items)
+		for _, c := range cases {
+			b.Run(fmt.Sprintf("items=%d/%s", items, c.name), func(b *testing.B) {
+				hub, ts := makeTestHubWithOptions(HubOptions{c.opts})
+				defer func() {
+					hub.RemoveAllConnections()
+					ts.Close()
+				}()
+				hub.RegisterMethod("echo", func(params []any) (any, error) {
+					return params, nil
+				})
+				var written int64
+				client, err := dialCounting(HttpToWsAddr(ts.URL), c.opts, &written)
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer client.Close()
+				start := atomic.LoadInt64(&written)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					_, err := client.Call("echo", doc)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StopTimer()
+				b.ReportMetric(float64(atomic.LoadInt64(&written)-start)/float64(b.N), "wire-B/op")
+			})
+		}
+	}
+}
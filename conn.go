@@ -1,110 +1,200 @@
 package jsonrpc
 
 import (
+	"context"
+	"io"
 	"log"
-	"time"
+	"net"
+	"sync"
 
 	"github.com/gorilla/websocket"
 )
 
 type Connection struct {
 	*Protocol
-	conn   *websocket.Conn
-	closer ConnectionMux
-	send   chan *RpcMessage
+	transport Transport
+	codec     Codec
+	closer    ConnectionMux
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	session   *Session
+	ctx       context.Context
+	cancel    context.CancelFunc
 }
 
-func NewWebSocket(url string) (*websocket.Conn, error) {
-	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+// NewWebSocket dials a websocket with the buffer sizes and compression of
+// the options. The other options apply to the connection running on it.
+func NewWebSocket(url string, opts ...ConnectionOptions) (*websocket.Conn, error) {
+	return dialWebSocket(url, nil, connectionOptions(opts))
+}
+
+// dialWebSocket dials the url requesting the subprotocols.
+func dialWebSocket(url string, subprotocols []string, opts ConnectionOptions) (*websocket.Conn, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = subprotocols
+	dialer.ReadBufferSize = opts.ReadBufferSize
+	dialer.WriteBufferSize = opts.WriteBufferSize
+	dialer.EnableCompression = opts.Compression
+	conn, _, err := dialer.Dial(url, nil)
 	if err != nil {
 		log.Printf("error: %v", err)
 		return nil, err
 	}
-	conn.SetReadLimit(maxMessageSize)
-	conn.SetPongHandler(func(appData string) error {
-		return conn.SetReadDeadline(time.Now().Add(pongWait))
-	})
-
 	return conn, nil
 }
-func NewConnection(conn *websocket.Conn, methods *Methods, closer ConnectionMux) *Connection {
+
+// NewConnection runs the protocol over a websocket.
+func NewConnection(conn *websocket.Conn, methods *Methods, closer ConnectionMux, opts ...ConnectionOptions) *Connection {
+	return NewCodecConnection(conn, JSONCodec, methods, closer, opts...)
+}
+
+// NewCodecConnection runs the protocol over a websocket with messages
+// encoded by the codec, in binary frames if the codec is binary.
+func NewCodecConnection(conn *websocket.Conn, codec Codec, methods *Methods, closer ConnectionMux, opts ...ConnectionOptions) *Connection {
+	o := connectionOptions(opts)
+	return newConnection(context.Background(), newWebSocketTransport(conn, codec.Binary(), o), codec, methods, closer, DispatchOptions{}, o)
+}
+
+// NewTransportConnection runs the protocol over the transport.
+func NewTransportConnection(t Transport, methods *Methods, closer ConnectionMux, opts ...ConnectionOptions) *Connection {
+	return newConnection(context.Background(), t, JSONCodec, methods, closer, DispatchOptions{}, connectionOptions(opts))
+}
+
+// newConnection creates a connection whose handlers see the values of ctx.
+func newConnection(ctx context.Context, t Transport, codec Codec, methods *Methods, closer ConnectionMux, dispatch DispatchOptions, opts ConnectionOptions) *Connection {
 	c := &Connection{
-		conn:   conn,
-		closer: closer,
-		send:   make(chan *RpcMessage),
+		transport: t,
+		codec:     codec,
+		closer:    closer,
+		send:      make(chan []byte, opts.SendQueue),
+		done:      make(chan struct{}),
+		session:   NewSession(),
+	}
+	if a, ok := t.(interface{ RemoteAddr() net.Addr }); ok && RemoteAddrFromContext(ctx) == "" {
+		ctx = context.WithValue(ctx, remoteAddrKey, a.RemoteAddr().String())
 	}
+	ctx = context.WithValue(ctx, connectionKey, c)
+	ctx = context.WithValue(ctx, sessionKey, c.session)
+	c.ctx, c.cancel = context.WithCancel(ctx)
 	c.Protocol = NewProtocol(c, methods)
+	c.Protocol.ctx = c.ctx
+	c.SetDispatch(dispatch)
 	go c.ReadPump()
 	go c.writePump()
 	return c
 }
 
+// Close closes the connection and fails all pending calls with ErrConnectionClosed.
 func (c *Connection) Close() {
+	c.closeOnce.Do(c.close)
+}
+
+// Context returns the context of the connection. It is done once the
+// connection is closed.
+func (c *Connection) Context() context.Context {
+	return c.ctx
+}
+
+// Session returns the values kept for the lifetime of the connection.
+func (c *Connection) Session() *Session {
+	return c.session
+}
+
+func (c *Connection) close() {
+	close(c.done)
+	c.cancel()
+	c.stopDispatch()
+	c.failPending(ErrConnectionClosed)
 	// call close on hub with connection
 	if c.closer != nil {
 		c.closer.RemoveConnection(c)
 	}
-	err := c.conn.WriteControl(websocket.CloseMessage, []byte{}, time.Now().Add(time.Second))
-	if err != nil {
-		log.Printf("error: %v", err)
-	}
-	err = c.conn.Close()
+	err := c.transport.Close()
 	if err != nil {
 		log.Printf("error: %v", err)
 	}
 }
 
 func (c *Connection) SendMessage(msg *RpcMessage) error {
-	c.send <- msg
-	return nil
+	return c.sendEncoded(context.Background(), msg)
+}
+
+// SendBatch sends several messages as one batch frame.
+func (c *Connection) SendBatch(msgs []*RpcMessage) error {
+	return c.sendEncoded(context.Background(), msgs)
+}
+
+func (c *Connection) sendMessageContext(ctx context.Context, msg *RpcMessage) error {
+	return c.sendEncoded(ctx, msg)
+}
+
+func (c *Connection) sendBatchContext(ctx context.Context, msgs []*RpcMessage) error {
+	return c.sendEncoded(ctx, msgs)
+}
+
+// Codec returns the codec encoding the messages of the connection.
+func (c *Connection) Codec() Codec {
+	return c.codec
+}
+
+// sendEncoded queues the message or batch. It gives up when the send queue
+// stays full until the context is done.
+func (c *Connection) sendEncoded(ctx context.Context, v any) error {
+	data, err := encode(c.codec, v)
+	if err != nil {
+		return err
+	}
+	select {
+	case c.send <- data:
+		return nil
+	default:
+	}
+	select {
+	case c.send <- data:
+		return nil
+	case <-c.done:
+		return ErrConnectionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (c *Connection) ReadPump() {
 	defer func() {
 		c.Close()
 	}()
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	for {
-		msg := &RpcMessage{}
-		err := c.conn.ReadJSON(msg)
+		data, err := c.transport.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if err != io.EOF {
 				log.Printf("error: %v", err)
 			}
 			break
 		}
-		c.handleMessage(msg)
+		data, err = toJSON(c.codec, data)
+		if err != nil {
+			c.SendMessage(MakeError(ErrorCodeParse, "Parse error", nil))
+			continue
+		}
+		c.handleData(data)
 	}
 }
 
 func (c *Connection) writePump() {
-	ticker := time.NewTicker(pingPeriod)
 	defer func() {
-		ticker.Stop()
 		c.Close()
 	}()
 	for {
 		select {
-		case msg, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				log.Printf("the hub closed the connection")
-				c.Close()
-				return
-			}
-			err := c.conn.WriteJSON(msg)
-			if err != nil {
-				log.Printf("error: %v", err)
-				c.Close()
-				return
-			}
-		case <-ticker.C:
-			err := c.conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(time.Second))
+		case data := <-c.send:
+			err := c.transport.WriteMessage(data)
 			if err != nil {
 				log.Printf("error: %v", err)
-				c.Close()
 				return
 			}
+		case <-c.done:
+			return
 		}
 	}
 }
@@ -1,9 +1,12 @@
 package jsonrpc
 
 import (
+	"context"
+	"errors"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -63,3 +66,317 @@ func TestNewConnection(t *testing.T) {
 	isCalled := <-done
 	assert.True(t, isCalled)
 }
+
+func TestBatch(t *testing.T) {
+	hub, ts := makeTestHub()
+	client, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+
+	defer func() {
+		hub.RemoveAllConnections()
+		client.Close()
+		ts.Close()
+	}()
+
+	hub.RegisterMethod("echo", func(args []any) (any, error) {
+		return args[0], nil
+	})
+	done := make(chan bool, 1)
+	hub.RegisterMethod("notify", func(args []any) (any, error) {
+		done <- true
+		return nil, nil
+	})
+	batch := client.Batch()
+	first := batch.Call("echo", []any{"first"})
+	batch.Notify("notify", nil)
+	second := batch.Call("echo", []any{"second"})
+	missing := batch.Call("missing", nil)
+	assert.Equal(t, 4, batch.Len())
+	err = batch.Send()
+	assert.NoError(t, err)
+	assert.NoError(t, first.Error)
+	assert.Equal(t, "first", first.Result)
+	assert.NoError(t, second.Error)
+	assert.Equal(t, "second", second.Result)
+	assert.Error(t, missing.Error)
+	assert.True(t, <-done)
+}
+
+func TestCallNamed(t *testing.T) {
+	hub, ts := makeTestHub()
+	client, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+
+	defer func() {
+		hub.RemoveAllConnections()
+		client.Close()
+		ts.Close()
+	}()
+
+	hub.RegisterNamedMethod("greet", func(params map[string]any) (any, error) {
+		return "hello " + params["name"].(string), nil
+	})
+	result, err := client.CallNamed("greet", struct {
+		Name string `json:"name"`
+	}{"world"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", result)
+
+	_, err = client.CallNamed("greet", []any{"world"})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+}
+
+func TestCallContext(t *testing.T) {
+	hub, ts := makeTestHub()
+	client, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+
+	defer func() {
+		hub.RemoveAllConnections()
+		ts.Close()
+	}()
+
+	release := make(chan bool)
+	hub.RegisterMethod("block", func(args []any) (any, error) {
+		<-release
+		return nil, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.CallContext(ctx, "block", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	close(release)
+
+	done := make(chan error)
+	hub.RegisterMethod("hang", func(args []any) (any, error) {
+		client.Close()
+		return nil, nil
+	})
+	go func() {
+		_, err := client.CallContext(context.Background(), "hang", nil)
+		done <- err
+	}()
+	assert.ErrorIs(t, <-done, ErrConnectionClosed)
+	_, err = client.Call("hang", nil)
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+}
+
+// test calls give up on a full send queue at their deadline
+func TestCallContextSendQueueFull(t *testing.T) {
+	// nobody reads the other end of the pipe
+	a, _ := NewPipe()
+	c := NewTransportConnection(a, NewRegistry(), nil, ConnectionOptions{SendQueue: 1})
+	defer c.Close()
+	for i := 0; i < 4; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		start := time.Now()
+		_, err := c.CallContext(ctx, "test", nil)
+		cancel()
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	assert.Equal(t, 0, len(c.pending))
+}
+
+func TestHandlerContext(t *testing.T) {
+	hub, ts := makeTestHub()
+	client, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+	other, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+
+	defer func() {
+		hub.RemoveAllConnections()
+		client.Close()
+		other.Close()
+		ts.Close()
+	}()
+
+	err = hub.Register("login", func(ctx context.Context, user string) (string, error) {
+		assert.NotNil(t, ConnectionFromContext(ctx))
+		assert.False(t, RequestIdFromContext(ctx).IsNull())
+		assert.NotEmpty(t, HTTPRequestIdFromContext(ctx))
+		assert.NotEmpty(t, RemoteAddrFromContext(ctx))
+		SessionFromContext(ctx).Set("user", user)
+		return user, nil
+	})
+	assert.NoError(t, err)
+	hub.RegisterContextMethod("whoami", func(ctx context.Context, params []any) (any, error) {
+		// reply to the caller only
+		err := ConnectionFromContext(ctx).SendNotify("hello", []any{SessionFromContext(ctx).Get("user")})
+		return SessionFromContext(ctx).Get("user"), err
+	})
+	hello := make(chan any, 1)
+	client.RegisterMethod("hello", func(args []any) (any, error) {
+		hello <- args[0]
+		return nil, nil
+	})
+	otherHello := make(chan any, 1)
+	other.RegisterMethod("hello", func(args []any) (any, error) {
+		otherHello <- args[0]
+		return nil, nil
+	})
+
+	_, err = client.Call("login", []any{"alice"})
+	assert.NoError(t, err)
+	result, err := client.Call("whoami", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", result)
+	assert.Equal(t, "alice", <-hello)
+	result, err = other.Call("whoami", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+	assert.Nil(t, <-otherHello)
+	assert.Equal(t, 0, len(hello))
+}
+
+func TestNestedCall(t *testing.T) {
+	hub, ts := makeTestHub()
+	client, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+
+	defer func() {
+		hub.RemoveAllConnections()
+		client.Close()
+		ts.Close()
+	}()
+
+	client.RegisterMethod("client.name", func(args []any) (any, error) {
+		return "client", nil
+	})
+	err = hub.Register("greet", func(ctx context.Context) (string, error) {
+		// call back into the client while handling its call
+		name, err := ConnectionFromContext(ctx).CallContext(ctx, "client.name", nil)
+		if err != nil {
+			return "", err
+		}
+		return "hello " + name.(string), nil
+	})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := client.CallContext(ctx, "greet", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello client", result)
+}
+
+func TestRemoteCancel(t *testing.T) {
+	hub, ts := makeTestHub()
+	hub.SetDispatch(DispatchOptions{Mode: DispatchUnbounded, MaxInFlight: 10})
+	client, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+
+	defer func() {
+		hub.RemoveAllConnections()
+		client.Close()
+		ts.Close()
+	}()
+
+	started := make(chan bool)
+	cancelled := make(chan bool)
+	err = hub.Register("wait", func(ctx context.Context) error {
+		started <- true
+		<-ctx.Done()
+		cancelled <- true
+		return ctx.Err()
+	})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := client.CallContext(ctx, "wait", nil)
+		errs <- err
+	}()
+	<-started
+	// cancelling the call cancels the remote handler
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	assert.True(t, <-cancelled)
+}
+
+func TestConcurrentCalls(t *testing.T) {
+	hub, ts := makeTestHub()
+	hub.SetDispatch(DispatchOptions{Mode: DispatchPool, Workers: 2})
+	client, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+
+	defer func() {
+		hub.RemoveAllConnections()
+		client.Close()
+		ts.Close()
+	}()
+
+	started := make(chan bool)
+	release := make(chan bool)
+	hub.RegisterMethod("wait", func(args []any) (any, error) {
+		started <- true
+		<-release
+		return "done", nil
+	})
+	hub.RegisterMethod("echo", func(args []any) (any, error) {
+		return args[0], nil
+	})
+	results := make(chan any)
+	go func() {
+		result, _ := client.Call("wait", nil)
+		results <- result
+	}()
+	<-started
+	// a slow handler does not block other calls
+	result, err := client.Call("echo", []any{"test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "test", result)
+	close(release)
+	assert.Equal(t, "done", <-results)
+}
+
+func TestPanicKeepsConnection(t *testing.T) {
+	hub, ts := makeTestHub()
+	client, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+
+	defer func() {
+		hub.RemoveAllConnections()
+		client.Close()
+		ts.Close()
+	}()
+
+	hub.RegisterMethod("panic", func(args []any) (any, error) {
+		panic("boom")
+	})
+	hub.RegisterMethod("test", func(args []any) (any, error) {
+		return "test", nil
+	})
+	_, err = client.Call("panic", nil)
+	assert.Error(t, err)
+	result, err := client.Call("test", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", result)
+}
+
+func TestRemoteError(t *testing.T) {
+	hub, ts := makeTestHub()
+	client, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+
+	defer func() {
+		hub.RemoveAllConnections()
+		client.Close()
+		ts.Close()
+	}()
+
+	hub.RegisterMethod("fail", func(args []any) (any, error) {
+		return nil, &RpcError{Code: -32050, Message: "failure", Data: "data"}
+	})
+	_, err = client.Call("fail", nil)
+	var rpcErr *RpcError
+	assert.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, ErrorCode(-32050), rpcErr.Code)
+	assert.Equal(t, "failure", rpcErr.Message)
+	assert.Equal(t, "data", rpcErr.Data)
+
+	_, err = client.Call("missing", nil)
+	assert.ErrorIs(t, err, ErrMethodNotFound)
+}
@@ -41,7 +41,13 @@ func (r *Connections) BroadcastMessage(msg *RpcMessage) {
 
 func (r *Connections) RemoveAllConnections() {
 	log.Println("Closing all connections")
+	r.mutex.Lock()
+	conns := make([]*Connection, 0, len(r.connections))
 	for conn := range r.connections {
+		conns = append(conns, conn)
+	}
+	r.mutex.Unlock()
+	for _, conn := range conns {
 		r.RemoveConnection(conn)
 	}
 }
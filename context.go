@@ -0,0 +1,88 @@
+package jsonrpc
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type contextKey int
+
+const (
+	connectionKey contextKey = iota
+	requestIdKey
+	httpRequestIdKey
+	remoteAddrKey
+	sessionKey
+)
+
+// Session holds values which live as long as a connection.
+type Session struct {
+	mutex  sync.Mutex
+	values map[string]any
+}
+
+func NewSession() *Session {
+	return &Session{
+		values: make(map[string]any),
+	}
+}
+
+func (s *Session) Get(key string) any {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.values[key]
+}
+
+func (s *Session) Set(key string, value any) {
+	s.mutex.Lock()
+	s.values[key] = value
+	s.mutex.Unlock()
+}
+
+func (s *Session) Delete(key string) {
+	s.mutex.Lock()
+	delete(s.values, key)
+	s.mutex.Unlock()
+}
+
+// ConnectionFromContext returns the connection a call came in on.
+func ConnectionFromContext(ctx context.Context) *Connection {
+	c, _ := ctx.Value(connectionKey).(*Connection)
+	return c
+}
+
+// RequestIdFromContext returns the JSON-RPC id of the call.
+// The id is zero for notifications.
+func RequestIdFromContext(ctx context.Context) Id {
+	id, _ := ctx.Value(requestIdKey).(Id)
+	return id
+}
+
+// HTTPRequestIdFromContext returns the request id assigned by
+// middleware.RequestID to the HTTP request which opened the connection.
+func HTTPRequestIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(httpRequestIdKey).(string)
+	return id
+}
+
+// RemoteAddrFromContext returns the address of the peer.
+func RemoteAddrFromContext(ctx context.Context) string {
+	addr, _ := ctx.Value(remoteAddrKey).(string)
+	return addr
+}
+
+// SessionFromContext returns the session of the connection a call came in on.
+func SessionFromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey).(*Session)
+	return s
+}
+
+// requestContext keeps the details of the HTTP request which opened
+// a connection. Unlike the request context it outlives the request.
+func requestContext(r *http.Request) context.Context {
+	ctx := context.WithValue(context.Background(), httpRequestIdKey, middleware.GetReqID(r.Context()))
+	return context.WithValue(ctx, remoteAddrKey, r.RemoteAddr)
+}
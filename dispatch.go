@@ -0,0 +1,152 @@
+package jsonrpc
+
+import (
+	"sync"
+)
+
+// DispatchMode selects how a connection runs incoming calls and notifications.
+// Results and errors are always handled as they arrive, so a handler can
+// make calls of its own and wait for their results.
+type DispatchMode int
+
+const (
+	// DispatchSequential runs requests one at a time in arrival order.
+	DispatchSequential DispatchMode = iota
+	// DispatchPool runs requests on a fixed number of workers.
+	DispatchPool
+	// DispatchUnbounded runs each request on its own goroutine.
+	DispatchUnbounded
+)
+
+// DispatchOptions configures how a connection runs incoming requests.
+type DispatchOptions struct {
+	Mode DispatchMode
+	// Workers is the number of workers of DispatchPool. Defaults to 4.
+	Workers int
+	// MaxInFlight limits the requests running at once, further requests
+	// wait for a running one to finish. The connection keeps reading, so
+	// handlers waiting for the results of their own calls get them. Zero
+	// is no limit.
+	MaxInFlight int
+}
+
+// dispatcher runs requests according to the dispatch options.
+type dispatcher struct {
+	mode    DispatchMode
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	queue   []func()
+	stopped bool
+	drain   bool
+	slots   chan struct{}
+	done    chan struct{}
+}
+
+func newDispatcher(opts DispatchOptions) *dispatcher {
+	d := &dispatcher{
+		mode: opts.Mode,
+		done: make(chan struct{}),
+	}
+	d.cond = sync.NewCond(&d.mutex)
+	if opts.MaxInFlight > 0 {
+		d.slots = make(chan struct{}, opts.MaxInFlight)
+	}
+	workers := 0
+	switch opts.Mode {
+	case DispatchSequential:
+		workers = 1
+	case DispatchPool:
+		workers = opts.Workers
+		if workers <= 0 {
+			workers = 4
+		}
+	}
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// run schedules the job. It never blocks, jobs wait for a slot when
+// MaxInFlight jobs are running.
+func (d *dispatcher) run(job func()) {
+	task := func() {
+		if !d.acquire() {
+			return
+		}
+		defer d.release()
+		job()
+	}
+	if d.mode == DispatchUnbounded {
+		go task()
+		return
+	}
+	d.mutex.Lock()
+	if !d.stopped {
+		d.queue = append(d.queue, task)
+		d.cond.Signal()
+	}
+	d.mutex.Unlock()
+}
+
+// acquire takes a slot. It gives up once the dispatcher is stopped
+// without draining.
+func (d *dispatcher) acquire() bool {
+	if d.slots == nil {
+		return true
+	}
+	select {
+	case d.slots <- struct{}{}:
+		return true
+	case <-d.done:
+	}
+	d.mutex.Lock()
+	drain := d.drain
+	d.mutex.Unlock()
+	if !drain {
+		return false
+	}
+	d.slots <- struct{}{}
+	return true
+}
+
+func (d *dispatcher) release() {
+	if d.slots != nil {
+		<-d.slots
+	}
+}
+
+func (d *dispatcher) work() {
+	for {
+		d.mutex.Lock()
+		for len(d.queue) == 0 && !d.stopped {
+			d.cond.Wait()
+		}
+		if len(d.queue) == 0 {
+			d.mutex.Unlock()
+			return
+		}
+		job := d.queue[0]
+		d.queue = d.queue[1:]
+		d.mutex.Unlock()
+		job()
+	}
+}
+
+// stop stops the workers. When drain is set, queued jobs still run,
+// otherwise they are dropped.
+func (d *dispatcher) stop(drain bool) {
+	d.mutex.Lock()
+	if d.stopped {
+		d.mutex.Unlock()
+		return
+	}
+	d.stopped = true
+	d.drain = drain
+	if !drain {
+		d.queue = nil
+	}
+	d.cond.Broadcast()
+	d.mutex.Unlock()
+	close(d.done)
+}
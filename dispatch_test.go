@@ -0,0 +1,163 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// test sequential dispatch keeps the order
+func TestDispatchSequential(t *testing.T) {
+	d := newDispatcher(DispatchOptions{})
+	defer d.stop(false)
+	var mutex sync.Mutex
+	order := []int{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		i := i
+		wg.Add(1)
+		d.run(func() {
+			mutex.Lock()
+			order = append(order, i)
+			mutex.Unlock()
+			wg.Done()
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, order)
+}
+
+// test dispatch limits the jobs in flight
+func TestDispatchMaxInFlight(t *testing.T) {
+	for _, mode := range []DispatchMode{DispatchPool, DispatchUnbounded} {
+		d := newDispatcher(DispatchOptions{Mode: mode, Workers: 8, MaxInFlight: 2})
+		var running, max int32
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			d.run(func() {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				wg.Done()
+			})
+		}
+		wg.Wait()
+		d.stop(false)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&max))
+	}
+}
+
+// test stop with drain runs queued jobs
+func TestDispatchStopDrain(t *testing.T) {
+	d := newDispatcher(DispatchOptions{})
+	release := make(chan bool)
+	done := make(chan bool, 2)
+	d.run(func() {
+		<-release
+		done <- true
+	})
+	d.run(func() {
+		done <- true
+	})
+	d.stop(true)
+	close(release)
+	assert.True(t, <-done)
+	assert.True(t, <-done)
+}
+
+// test a handler calling back the client while the limit is reached
+func TestNestedCallMaxInFlight(t *testing.T) {
+	for _, mode := range []DispatchMode{DispatchSequential, DispatchPool, DispatchUnbounded} {
+		a, b := NewPipe()
+		server := NewTransportClient(a)
+		server.Conn.SetDispatch(DispatchOptions{Mode: mode, MaxInFlight: 1})
+		client := NewTransportClient(b)
+		started := make(chan bool)
+		server.RegisterContextMethod("outer", func(ctx context.Context, params []any) (any, error) {
+			started <- true
+			return ConnectionFromContext(ctx).CallContext(ctx, "inner", nil)
+		})
+		server.RegisterMethod("other", func(params []any) (any, error) {
+			return "other", nil
+		})
+		client.RegisterMethod("inner", func(params []any) (any, error) {
+			// let other arrive while outer holds the slot
+			time.Sleep(20 * time.Millisecond)
+			return "inner", nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		outer := make(chan any, 1)
+		go func() {
+			result, err := client.CallContext(ctx, "outer", nil)
+			assert.NoError(t, err)
+			outer <- result
+		}()
+		<-started
+		// waits for the slot of outer
+		other, err := client.CallContext(ctx, "other", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "other", other)
+		assert.Equal(t, "inner", <-outer)
+		cancel()
+		client.Close()
+	}
+}
+
+// test a cancel request reaches a call waiting for the dispatcher
+func TestCancelQueuedCall(t *testing.T) {
+	a, b := NewPipe()
+	server := NewTransportClient(a)
+	client := NewTransportClient(b)
+	defer client.Close()
+	started := make(chan bool)
+	release := make(chan bool)
+	server.RegisterMethod("block", func(params []any) (any, error) {
+		started <- true
+		<-release
+		return nil, nil
+	})
+	ran := make(chan bool, 1)
+	server.RegisterMethod("queued", func(params []any) (any, error) {
+		ran <- true
+		return nil, nil
+	})
+	cancelled := func() bool {
+		server.Conn.mutex.Lock()
+		defer server.Conn.mutex.Unlock()
+		call, ok := server.Conn.inflight[NumberId(2)]
+		return ok && call.ctx.Err() != nil
+	}
+
+	go client.Call("block", nil)
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.CallContext(ctx, "queued", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Eventually(t, cancelled, time.Second, time.Millisecond)
+	close(release)
+
+	// the queued call is answered as cancelled without running
+	assert.Eventually(t, func() bool {
+		server.Conn.mutex.Lock()
+		defer server.Conn.mutex.Unlock()
+		return len(server.Conn.inflight) == 0
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case <-ran:
+		t.Fatal("cancelled call ran")
+	default:
+	}
+}
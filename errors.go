@@ -0,0 +1,120 @@
+package jsonrpc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// CodedError is implemented by errors which carry their own error code and
+// data. A method returning such an error replies with its code and data.
+type CodedError interface {
+	error
+	ErrorCode() ErrorCode
+	ErrorData() any
+}
+
+func (e *RpcError) Error() string {
+	return fmt.Sprintf("jsonrpc error: %d: %s", e.Code, e.Message)
+}
+
+func (e *RpcError) ErrorCode() ErrorCode {
+	return e.Code
+}
+
+func (e *RpcError) ErrorData() any {
+	return e.Data
+}
+
+// Is reports whether the error code is registered for the target error,
+// so that errors.Is(err, ErrMethodNotFound) holds for a remote error with
+// code ErrorCodeMethodNotFound.
+func (e *RpcError) Is(target error) bool {
+	sentinel, ok := lookupError(e.Code)
+	return ok && sentinel == target
+}
+
+type errorMapping struct {
+	code ErrorCode
+	err  error
+}
+
+// builtinErrors maps the sentinels of the reserved codes.
+var builtinErrors = []errorMapping{
+	{ErrorCodeMethodNotFound, ErrMethodNotFound},
+	{ErrorCodeInvalidParams, ErrInvalidParams},
+	{ErrorCodeInternal, ErrInternal},
+}
+
+var (
+	errorMutex    sync.RWMutex
+	errorMappings = append([]errorMapping{}, builtinErrors...)
+)
+
+// RegisterError maps a sentinel error to an application error code.
+// Methods returning an error which wraps err reply with the code, and
+// callers receiving the code get an error matching err with errors.Is.
+// Codes between -32768 and -32100 are reserved by JSON-RPC, application
+// codes typically are in the range from -32099 to -32000. Registering a
+// code or error again replaces its previous mapping, the sentinels of the
+// reserved codes cannot be remapped.
+func RegisterError(code ErrorCode, err error) error {
+	if code >= -32768 && code <= -32100 {
+		return fmt.Errorf("jsonrpc: error code %d is reserved", code)
+	}
+	for _, m := range builtinErrors {
+		if m.err == err {
+			return fmt.Errorf("jsonrpc: error %q is reserved for code %d", err, m.code)
+		}
+	}
+	errorMutex.Lock()
+	defer errorMutex.Unlock()
+	mappings := errorMappings[:0]
+	for _, m := range errorMappings {
+		if m.code != code && m.err != err {
+			mappings = append(mappings, m)
+		}
+	}
+	errorMappings = append(mappings, errorMapping{code, err})
+	return nil
+}
+
+func lookupError(code ErrorCode) (error, bool) {
+	errorMutex.RLock()
+	defer errorMutex.RUnlock()
+	for _, m := range errorMappings {
+		if m.code == code {
+			return m.err, true
+		}
+	}
+	return nil, false
+}
+
+func lookupErrorCode(err error) (ErrorCode, bool) {
+	errorMutex.RLock()
+	defer errorMutex.RUnlock()
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			return m.code, true
+		}
+	}
+	return 0, false
+}
+
+// toRpcError converts an error returned by a method into the error sent
+// to the caller. Errors without a code are internal errors.
+func toRpcError(err error) *RpcError {
+	var rpcErr *RpcError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	var coded CodedError
+	if errors.As(err, &coded) {
+		return &RpcError{Code: coded.ErrorCode(), Message: err.Error(), Data: coded.ErrorData()}
+	}
+	code, ok := lookupErrorCode(err)
+	if !ok {
+		code = ErrorCodeInternal
+	}
+	return &RpcError{Code: code, Message: err.Error()}
+}
@@ -0,0 +1,122 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errNotFound = errors.New("not found")
+
+type quotaError struct {
+	limit int
+}
+
+func (e quotaError) Error() string {
+	return "quota exceeded"
+}
+
+func (e quotaError) ErrorCode() ErrorCode {
+	return -32010
+}
+
+func (e quotaError) ErrorData() any {
+	return map[string]any{"limit": e.limit}
+}
+
+func TestRegisterError(t *testing.T) {
+	assert.Error(t, RegisterError(-32600, errNotFound))
+	assert.NoError(t, RegisterError(-32001, errNotFound))
+	code, ok := lookupErrorCode(fmt.Errorf("user 1: %w", errNotFound))
+	assert.True(t, ok)
+	assert.Equal(t, ErrorCode(-32001), code)
+	err := &RpcError{Code: -32001, Message: "not found"}
+	assert.ErrorIs(t, err, errNotFound)
+	assert.NotErrorIs(t, err, ErrMethodNotFound)
+}
+
+func TestRegisterErrorReplaces(t *testing.T) {
+	errorMutex.RLock()
+	saved := append([]errorMapping{}, errorMappings...)
+	errorMutex.RUnlock()
+	t.Cleanup(func() {
+		errorMutex.Lock()
+		errorMappings = saved
+		errorMutex.Unlock()
+	})
+	errConflict := errors.New("conflict")
+	assert.Error(t, RegisterError(-32002, ErrInternal))
+	assert.NoError(t, RegisterError(-32001, errNotFound))
+	assert.NoError(t, RegisterError(-32002, errConflict))
+	// both the code of errNotFound and the mapping of errConflict go
+	assert.NoError(t, RegisterError(-32001, errConflict))
+	sentinel, ok := lookupError(-32001)
+	assert.True(t, ok)
+	assert.Equal(t, errConflict, sentinel)
+	_, ok = lookupError(-32002)
+	assert.False(t, ok)
+	_, ok = lookupErrorCode(errNotFound)
+	assert.False(t, ok)
+	code, ok := lookupErrorCode(ErrInternal)
+	assert.True(t, ok)
+	assert.Equal(t, ErrorCodeInternal, code)
+}
+
+func TestToRpcError(t *testing.T) {
+	assert.NoError(t, RegisterError(-32001, errNotFound))
+	tests := []struct {
+		name string
+		err  error
+		code ErrorCode
+		data any
+	}{
+		{"rpc error", &RpcError{Code: -32005, Message: "test", Data: "data"}, -32005, "data"},
+		{"wrapped rpc error", fmt.Errorf("wrapped: %w", &RpcError{Code: -32005, Message: "test"}), -32005, nil},
+		{"coded error", quotaError{limit: 10}, -32010, map[string]any{"limit": 10}},
+		{"sentinel", fmt.Errorf("user 1: %w", errNotFound), -32001, nil},
+		{"invalid params", ErrInvalidParams, ErrorCodeInvalidParams, nil},
+		{"plain error", errors.New("failure"), ErrorCodeInternal, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rpcErr := toRpcError(tt.err)
+			assert.Equal(t, tt.code, rpcErr.Code)
+			assert.Equal(t, tt.data, rpcErr.Data)
+		})
+	}
+}
+
+func TestReplyError(t *testing.T) {
+	assert.NoError(t, RegisterError(-32001, errNotFound))
+	r := NewRegistry()
+	r.Register("find", func(ctx context.Context, name string) (string, error) {
+		return "", fmt.Errorf("%s: %w", name, errNotFound)
+	})
+	r.Register("quota", func(ctx context.Context) error {
+		return quotaError{limit: 10}
+	})
+	s := NewMockMessageSender()
+	p := NewProtocol(s, r)
+	p.handleMessage(MakeCall(NumberId(1), "find", []any{"alice"}))
+	p.handleMessage(MakeCall(NumberId(2), "quota", nil))
+	p.handleMessage(MakeCall(NumberId(3), "missing", nil))
+	assert.Equal(t, 3, len(s.Messages))
+
+	_, err := replyResult(s.Messages[0])
+	assert.ErrorIs(t, err, errNotFound)
+	var rpcErr *RpcError
+	assert.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, ErrorCode(-32001), rpcErr.Code)
+	assert.Equal(t, "alice: not found", rpcErr.Message)
+
+	_, err = replyResult(s.Messages[1])
+	assert.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, ErrorCode(-32010), rpcErr.Code)
+	assert.Equal(t, map[string]any{"limit": 10}, rpcErr.Data)
+
+	_, err = replyResult(s.Messages[2])
+	assert.ErrorIs(t, err, ErrMethodNotFound)
+}
@@ -1,19 +1,28 @@
 package main
 
 import (
+	"context"
+	"sync"
+
 	"github.com/apigear-io/jsonrpc"
 )
 
+// Calc is shared by all connections, whose calls run in parallel.
 type Calc struct {
+	mutex sync.Mutex
 	Total int
 }
 
-func (c *Calc) Add(params []any) (any, error) {
-	c.Total += int(params[0].(float64))
+func (c *Calc) Add(ctx context.Context, value int) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Total += value
 	return c.Total, nil
 }
 
-func (c *Calc) Clear(params []any) (any, error) {
+func (c *Calc) Clear(ctx context.Context) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	c.Total = 0
 	return c.Total, nil
 }
@@ -21,9 +30,13 @@ func (c *Calc) Clear(params []any) (any, error) {
 func main() {
 	hub := jsonrpc.NewHub()
 	calc := &Calc{}
-	hub.RegisterMethod("calc.add", calc.Add)
-	hub.RegisterMethod("calc.clear", calc.Clear)
+	if err := hub.RegisterService("calc", calc); err != nil {
+		panic(err)
+	}
 	server := jsonrpc.NewHTTPServer()
 	server.Router().Get("/ws", hub.HandleRequest)
+	server.Router().Post("/rpc", hub.HandlePost)
+	server.Router().Get("/events", hub.HandleEvents)
+	server.Router().HandleFunc("/poll", hub.HandlePoll)
 	server.Start(":8080")
 }
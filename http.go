@@ -0,0 +1,163 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// replySender keeps the reply of a request sent over HTTP.
+type replySender struct {
+	mutex sync.Mutex
+	reply any
+}
+
+func (s *replySender) SendMessage(msg *RpcMessage) error {
+	s.mutex.Lock()
+	s.reply = msg
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *replySender) SendBatch(msgs []*RpcMessage) error {
+	s.mutex.Lock()
+	s.reply = msgs
+	s.mutex.Unlock()
+	return nil
+}
+
+// HandlePost runs a JSON-RPC request or batch posted in the request body
+// against the methods of the hub and writes the reply. Requests which only
+// hold notifications are answered with 204 No Content, parse errors and
+// invalid requests with 400 Bad Request.
+func (h *Hub) HandlePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.opts.ReadLimit))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	sender := &replySender{}
+	p := NewProtocol(sender, &h.Methods)
+	ctx := context.WithValue(r.Context(), httpRequestIdKey, middleware.GetReqID(r.Context()))
+	p.ctx = context.WithValue(ctx, remoteAddrKey, r.RemoteAddr)
+	p.handleData(data)
+	if sender.reply == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	status := http.StatusOK
+	if msg, ok := sender.reply.(*RpcMessage); ok && msg.Error != nil {
+		switch msg.Error.Code {
+		case ErrorCodeParse, ErrorCodeInvalidRequest:
+			status = http.StatusBadRequest
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(sender.reply)
+}
+
+// HTTPClient calls methods by posting requests to a JSON-RPC HTTP endpoint.
+type HTTPClient struct {
+	url    string
+	seq    uint64
+	client *http.Client
+}
+
+// NewHTTPClient creates a client posting to url with http.DefaultClient.
+func NewHTTPClient(url string) *HTTPClient {
+	return &HTTPClient{
+		url:    url,
+		client: http.DefaultClient,
+	}
+}
+
+// SetHTTPClient sets the client used to post requests, e.g. to set timeouts.
+func (c *HTTPClient) SetHTTPClient(client *http.Client) {
+	c.client = client
+}
+
+// Call sends a request to the server and waits for a response.
+func (c *HTTPClient) Call(method string, params []any) (any, error) {
+	return c.CallContext(context.Background(), method, params)
+}
+
+// CallContext sends a request to the server and waits for a response until
+// the context is done.
+func (c *HTTPClient) CallContext(ctx context.Context, method string, params []any) (any, error) {
+	return c.call(ctx, MakeCall(NumberId(atomic.AddUint64(&c.seq, 1)), method, params))
+}
+
+// CallNamed sends a request with params passed by name and waits for a response.
+// Params is a map or a struct which encodes to a JSON object.
+func (c *HTTPClient) CallNamed(method string, params any) (any, error) {
+	named, err := toNamedParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return c.call(context.Background(), MakeNamedCall(NumberId(atomic.AddUint64(&c.seq, 1)), method, named))
+}
+
+// Notify sends a notification to the server.
+func (c *HTTPClient) Notify(method string, params []any) error {
+	_, err := c.post(context.Background(), MakeNotify(method, params))
+	return err
+}
+
+func (c *HTTPClient) call(ctx context.Context, msg *RpcMessage) (any, error) {
+	data, err := c.post(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	reply := &RpcMessage{}
+	err = json.Unmarshal(data, reply)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Id != msg.Id && !reply.IsError() {
+		return nil, fmt.Errorf("jsonrpc: reply id %s does not match %s", reply.Id, msg.Id)
+	}
+	return replyResult(reply)
+}
+
+// post sends the message and returns the reply body. Error replies are
+// returned as body whatever the status.
+func (c *HTTPClient) post(ctx context.Context, msg *RpcMessage) ([]byte, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	isJSON := mediaType == "application/json"
+	if resp.StatusCode >= 300 && !isJSON {
+		return nil, fmt.Errorf("jsonrpc: http status %s", resp.Status)
+	}
+	return data, nil
+}
@@ -0,0 +1,112 @@
+package jsonrpc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestHTTPHub() (*Hub, *httptest.Server) {
+	hub := NewHub()
+	handler := NewRouter()
+	handler.Post("/rpc", hub.HandlePost)
+	ts := httptest.NewServer(handler)
+	return hub, ts
+}
+
+func postBody(t *testing.T, url string, body string) (int, string) {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp.StatusCode, strings.TrimSpace(string(data))
+}
+
+func TestHandlePost(t *testing.T) {
+	hub, ts := makeTestHTTPHub()
+	defer ts.Close()
+	notified := make(chan bool, 1)
+	hub.RegisterMethod("subtract", func(params []any) (any, error) {
+		return params[0].(float64) - params[1].(float64), nil
+	})
+	hub.RegisterMethod("update", func(params []any) (any, error) {
+		notified <- true
+		return nil, nil
+	})
+	url := ts.URL + "/rpc"
+
+	status, body := postBody(t, url, `{"jsonrpc":"2.0","method":"subtract","params":[42,23],"id":1}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":19,"id":1}`, body)
+
+	status, body = postBody(t, url, `{"jsonrpc":"2.0","method":"update","params":[1]}`)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, "", body)
+	assert.True(t, <-notified)
+
+	status, body = postBody(t, url, `{"jsonrpc":"2.0","method":"foobar,"params":"bar","baz]`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`, body)
+
+	status, body = postBody(t, url, `[{"jsonrpc":"2.0","method":"subtract","params":[2,1],"id":"a"},{"jsonrpc":"2.0","method":"foo","id":"b"}]`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"result":1`)
+	assert.Contains(t, body, `"code":-32601`)
+
+	status, _ = postBody(t, url, `[{"jsonrpc":"2.0","method":"update","params":[1]}]`)
+	assert.Equal(t, http.StatusNoContent, status)
+	<-notified
+
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestHTTPClient(t *testing.T) {
+	hub, ts := makeTestHTTPHub()
+	defer ts.Close()
+	hub.RegisterMethod("add", func(params []any) (any, error) {
+		return params[0].(float64) + params[1].(float64), nil
+	})
+	hub.RegisterNamedMethod("greet", func(params map[string]any) (any, error) {
+		return "hello " + params["name"].(string), nil
+	})
+	client := NewHTTPClient(ts.URL + "/rpc")
+
+	result, err := client.Call("add", []any{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), result)
+
+	result, err = client.CallNamed("greet", struct {
+		Name string `json:"name"`
+	}{"bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello bob", result)
+
+	_, err = client.Call("missing", nil)
+	assert.ErrorIs(t, err, ErrMethodNotFound)
+
+	assert.NoError(t, client.Notify("add", []any{1, 2}))
+
+	client = NewHTTPClient(ts.URL + "/missing")
+	_, err = client.Call("add", []any{1, 2})
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestHTTPClientErrorStatus(t *testing.T) {
+	// another server answering errors with status 500 and a charset
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Method not found"}}`)
+	}))
+	defer ts.Close()
+	_, err := NewHTTPClient(ts.URL).Call("missing", nil)
+	assert.ErrorIs(t, err, ErrMethodNotFound)
+}
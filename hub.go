@@ -16,38 +16,105 @@ type ConnectionMux interface {
 // Hub is the central hub for all connections and method registry.
 type Hub struct {
 	upgrader websocket.Upgrader
+	opts     HubOptions
+	dispatch DispatchOptions
+	codecs   []Codec
+	polls    pollSessions
 	Connections
 	Methods
 }
 
-func NewHub() *Hub {
+// NewHub creates a hub configured by the first options, if any.
+func NewHub(opts ...HubOptions) *Hub {
+	var o HubOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	o.ConnectionOptions = o.ConnectionOptions.withDefaults()
 	return &Hub{
+		opts: o,
 		upgrader: websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
+			ReadBufferSize:    o.ReadBufferSize,
+			WriteBufferSize:   o.WriteBufferSize,
+			EnableCompression: o.Compression,
 			CheckOrigin: func(r *http.Request) bool {
 				return true
 			},
+			Subprotocols: []string{subprotocol(JSONCodec)},
 		},
+		codecs: []Codec{JSONCodec},
 		Connections: Connections{
 			connections: make(map[*Connection]bool),
 		},
-		Methods: Methods{
-			methods: make(map[string]MethodHandle),
-		},
 	}
 }
 
+// HandleRequest upgrades the request to a websocket connection. Its codec
+// is negotiated by subprotocol, clients requesting no subprotocol use JSON
+// and clients sharing none are rejected.
 func (h *Hub) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	requested := websocket.Subprotocols(r)
+	if len(requested) > 0 && !h.supports(requested) {
+		http.Error(w, "unsupported subprotocols", http.StatusBadRequest)
+		return
+	}
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	c := NewConnection(conn, &h.Methods, h)
+	codec := JSONCodec
+	if name := conn.Subprotocol(); name != "" {
+		codec, _ = codecForSubprotocol(h.codecs, name)
+	}
+	c := newConnection(requestContext(r), newWebSocketTransport(conn, codec.Binary(), h.opts.ConnectionOptions), codec, &h.Methods, h, h.dispatch, h.opts.ConnectionOptions)
 	h.AddConnection(c)
 }
 
+// Upgrade upgrades the HTTP request to a websocket and returns it as a
+// transport, e.g. to relay its messages instead of serving them.
+func (h *Hub) Upgrade(w http.ResponseWriter, r *http.Request) (Transport, error) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebSocketTransport(conn, h.opts.ConnectionOptions), nil
+}
+
+// SetDispatch sets how connections run incoming requests. The default runs
+// them one at a time. It must be called before serving requests.
+func (h *Hub) SetDispatch(opts DispatchOptions) {
+	h.dispatch = opts
+}
+
+// SetCodec sets the codec of websocket connections requesting its
+// subprotocol. The default is JSONCodec. It must be called before serving
+// requests.
+func (h *Hub) SetCodec(codec Codec) {
+	h.SetCodecs(codec)
+}
+
+// SetCodecs sets the codecs websocket clients may choose from by
+// subprotocol, in order of preference. It must be called before serving
+// requests.
+func (h *Hub) SetCodecs(codecs ...Codec) {
+	h.codecs = codecs
+	h.upgrader.Subprotocols = make([]string, len(codecs))
+	for i, codec := range codecs {
+		h.upgrader.Subprotocols[i] = subprotocol(codec)
+	}
+}
+
+// supports reports whether the hub shares one of the subprotocols.
+func (h *Hub) supports(subprotocols []string) bool {
+	for _, name := range subprotocols {
+		if _, ok := codecForSubprotocol(h.codecs, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *Hub) Notify(method string, params []any) {
 	h.BroadcastMessage(MakeNotify(method, params))
 }
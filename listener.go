@@ -0,0 +1,51 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// Serve accepts connections on the listener, e.g. a TCP or Unix socket,
+// and runs each as a connection of the hub with one message per line.
+// Lines longer than the read limit of the hub close the connection. It
+// returns when accepting fails, e.g. because the listener is closed.
+func (h *Hub) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		ctx := context.WithValue(context.Background(), remoteAddrKey, conn.RemoteAddr().String())
+		c := newConnection(ctx, newLineTransport(conn, h.opts.ReadLimit), JSONCodec, &h.Methods, h, h.dispatch, h.opts.ConnectionOptions)
+		h.AddConnection(c)
+	}
+}
+
+// Dial connects a client to the address, which is one of
+// "tcp://host:port", "unix:///path/to/socket", "ws://host/path" or
+// "wss://host/path". Socket connections send one message per line.
+func Dial(addr string) (*RpcClient, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "tcp":
+		return dialStream("tcp", u.Host)
+	case "unix":
+		return dialStream("unix", u.Host+u.Path)
+	case "ws", "wss":
+		return DialWebSocket(addr, ConnectionOptions{})
+	}
+	return nil, fmt.Errorf("jsonrpc: unsupported address %q", addr)
+}
+
+func dialStream(network, address string) (*RpcClient, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewTransportClient(NewLineTransport(conn)), nil
+}
@@ -0,0 +1,82 @@
+package jsonrpc
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testServe(t *testing.T, network, address, dial string) {
+	hub := NewHub()
+	l, err := net.Listen(network, address)
+	assert.NoError(t, err)
+	if dial == "" {
+		dial = network + "://" + l.Addr().String()
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- hub.Serve(l)
+	}()
+	defer func() {
+		l.Close()
+		assert.Error(t, <-served)
+		hub.RemoveAllConnections()
+	}()
+	hub.RegisterMethod("echo", func(params []any) (any, error) {
+		return params[0], nil
+	})
+
+	client, err := Dial(dial)
+	assert.NoError(t, err)
+	defer client.Close()
+	result, err := client.Call("echo", []any{"hello"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", result)
+
+	done := make(chan bool, 1)
+	client.RegisterMethod("event", func(params []any) (any, error) {
+		done <- true
+		return nil, nil
+	})
+	hub.Notify("event", nil)
+	assert.True(t, <-done)
+}
+
+func TestServeTCP(t *testing.T) {
+	testServe(t, "tcp", "127.0.0.1:0", "")
+}
+
+func TestServeUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpc.sock")
+	testServe(t, "unix", path, "unix://"+path)
+}
+
+func TestDialUnsupported(t *testing.T) {
+	_, err := Dial("udp://127.0.0.1:1")
+	assert.ErrorContains(t, err, "unsupported")
+}
+
+func TestServeReadLimit(t *testing.T) {
+	hub := NewHub(HubOptions{ConnectionOptions{ReadLimit: 64}})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go hub.Serve(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	// a line without end closes the connection once it exceeds the limit
+	_, err = conn.Write([]byte(strings.Repeat("x", 10000)))
+	assert.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	// closed with unread data the peer may see a reset instead of EOF
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, os.ErrDeadlineExceeded), "connection not closed")
+}
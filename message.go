@@ -1,5 +1,15 @@
 package jsonrpc
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ProtocolVersion is the JSON-RPC version spoken by this package.
+const ProtocolVersion = "2.0"
+
 type ErrorCode int
 
 const (
@@ -13,6 +23,8 @@ const (
 	ErrorCodeInvalidParams ErrorCode = -32602
 	// InternalError indicates an internal JSON-RPC 2.0 error.
 	ErrorCodeInternal ErrorCode = -32603
+	// RequestCancelled indicates the call was cancelled by the caller.
+	ErrorCodeRequestCancelled ErrorCode = -32800
 )
 
 type RpcError struct {
@@ -21,21 +33,233 @@ type RpcError struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
+type idKind int
+
+const (
+	idNone idKind = iota
+	idNull
+	idNumber
+	idString
+)
+
+// Id is a JSON-RPC request id, either a number, a string or null.
+// The zero value is an absent id, as carried by notifications.
+type Id struct {
+	kind  idKind
+	value string
+}
+
+// NumberId returns a numeric id.
+func NumberId(n uint64) Id {
+	return Id{kind: idNumber, value: strconv.FormatUint(n, 10)}
+}
+
+// StringId returns a string id.
+func StringId(s string) Id {
+	return Id{kind: idString, value: s}
+}
+
+// NullId returns the null id used when a request id could not be determined.
+func NullId() Id {
+	return Id{kind: idNull}
+}
+
+// IsZero reports whether the id is absent.
+func (id Id) IsZero() bool {
+	return id.kind == idNone
+}
+
+// IsNull reports whether the id is absent or null.
+func (id Id) IsNull() bool {
+	return id.kind == idNone || id.kind == idNull
+}
+
+func (id Id) String() string {
+	switch id.kind {
+	case idNumber:
+		return id.value
+	case idString:
+		return strconv.Quote(id.value)
+	}
+	return "null"
+}
+
+func (id Id) MarshalJSON() ([]byte, error) {
+	switch id.kind {
+	case idNumber:
+		return []byte(id.value), nil
+	case idString:
+		return json.Marshal(id.value)
+	}
+	return []byte("null"), nil
+}
+
+func (id *Id) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*id = NullId()
+	case len(data) > 0 && data[0] == '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = StringId(s)
+	default:
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("invalid id: %s", data)
+		}
+		*id = Id{kind: idNumber, value: n.String()}
+	}
+	return nil
+}
+
 type RpcMessage struct {
-	Version string    `json:"version"`
-	Id      uint64    `json:"id"`
-	Method  string    `json:"method"`
-	Params  []any     `json:"params"`
-	Result  any       `json:"result"`
-	Error   *RpcError `json:"error"`
+	Version string `json:"jsonrpc"`
+	Id      Id     `json:"id"`
+	Method  string `json:"method,omitempty"`
+	Params  []any  `json:"params,omitempty"`
+	// NamedParams are params passed by name. They are sent as the params
+	// object and take precedence over Params.
+	NamedParams map[string]any `json:"-"`
+	Result      any            `json:"result,omitempty"`
+	Error       *RpcError      `json:"error,omitempty"`
+}
+
+// wireMessage is the on-the-wire layout of a RpcMessage.
+type wireMessage struct {
+	Version string          `json:"jsonrpc"`
+	Id      *Id             `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RpcError       `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes the message following the JSON-RPC 2.0 specification.
+// Requests omit empty params, notifications omit the id and responses carry
+// either a result or an error, never both.
+func (r RpcMessage) MarshalJSON() ([]byte, error) {
+	w := wireMessage{
+		Version: r.Version,
+		Method:  r.Method,
+		Error:   r.Error,
+	}
+	if w.Version == "" {
+		w.Version = ProtocolVersion
+	}
+	if !r.Id.IsZero() || r.Method == "" {
+		id := r.Id
+		w.Id = &id
+	}
+	if r.Method != "" {
+		var params any
+		if r.NamedParams != nil {
+			params = r.NamedParams
+		} else if len(r.Params) > 0 {
+			params = r.Params
+		}
+		if params != nil {
+			data, err := json.Marshal(params)
+			if err != nil {
+				return nil, err
+			}
+			w.Params = data
+		}
+	} else if r.Error == nil {
+		result, err := json.Marshal(r.Result)
+		if err != nil {
+			return nil, err
+		}
+		w.Result = result
+	}
+	return json.Marshal(w)
+}
+
+// UnmarshalJSON decodes a message and rejects members of the wrong type.
+func (r *RpcMessage) UnmarshalJSON(data []byte) error {
+	w := struct {
+		wireMessage
+		Id json.RawMessage `json:"id"`
+	}{}
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	msg := RpcMessage{
+		Version: w.Version,
+		Method:  w.Method,
+		Error:   w.Error,
+	}
+	if len(w.Id) > 0 {
+		if err := msg.Id.UnmarshalJSON(w.Id); err != nil {
+			return err
+		}
+	}
+	params := bytes.TrimSpace(w.Params)
+	if len(params) > 0 && !bytes.Equal(params, []byte("null")) {
+		var err error
+		switch params[0] {
+		case '[':
+			err = json.Unmarshal(params, &msg.Params)
+		case '{':
+			err = json.Unmarshal(params, &msg.NamedParams)
+		default:
+			err = fmt.Errorf("invalid params: %s", params)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(w.Result) > 0 {
+		if err := json.Unmarshal(w.Result, &msg.Result); err != nil {
+			return err
+		}
+	}
+	*r = msg
+	return nil
+}
+
+// toNamedParams converts a map or struct into params passed by name.
+func toNamedParams(params any) (map[string]any, error) {
+	if named, ok := params.(map[string]any); ok {
+		return named, nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	named := map[string]any{}
+	err = json.Unmarshal(data, &named)
+	if err != nil || bytes.Equal(data, []byte("null")) {
+		return nil, fmt.Errorf("%w: %T does not encode to an object", ErrInvalidParams, params)
+	}
+	return named, nil
+}
+
+// isBatch reports whether the frame holds a batch, i.e. a JSON array.
+func isBatch(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '['
+}
+
+// decodeMessage decodes a frame into a message. Frames which are no valid
+// request or response decode into a message without version, which is
+// then rejected as invalid request.
+func decodeMessage(data []byte) *RpcMessage {
+	msg := &RpcMessage{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return &RpcMessage{}
+	}
+	return msg
 }
 
 func (r RpcMessage) IsCall() bool {
-	return r.Id != 0 && r.Method != ""
+	return !r.Id.IsZero() && r.Method != ""
 }
 
 func (r RpcMessage) IsNotify() bool {
-	return r.Id == 0 && r.Method != ""
+	return r.Id.IsZero() && r.Method != ""
 }
 
 func (r RpcMessage) IsError() bool {
@@ -43,21 +267,31 @@ func (r RpcMessage) IsError() bool {
 }
 
 func (r RpcMessage) IsResult() bool {
-	return r.Id != 0 && r.Result != nil
+	return !r.Id.IsNull() && r.Method == "" && r.Error == nil
 }
 
-func MakeCall(id uint64, method string, params []any) *RpcMessage {
+func MakeCall(id Id, method string, params []any) *RpcMessage {
 	return &RpcMessage{
-		Version: "2.0",
+		Version: ProtocolVersion,
 		Id:      id,
 		Method:  method,
 		Params:  params,
 	}
 }
 
+// MakeNamedCall makes a call with params passed by name.
+func MakeNamedCall(id Id, method string, params map[string]any) *RpcMessage {
+	return &RpcMessage{
+		Version:     ProtocolVersion,
+		Id:          id,
+		Method:      method,
+		NamedParams: params,
+	}
+}
+
 func MakeError(code ErrorCode, message string, data interface{}) *RpcMessage {
 	return &RpcMessage{
-		Version: "2.0",
+		Version: ProtocolVersion,
 		Error: &RpcError{
 			Code:    code,
 			Message: message,
@@ -68,15 +302,31 @@ func MakeError(code ErrorCode, message string, data interface{}) *RpcMessage {
 
 func MakeNotify(method string, params []any) *RpcMessage {
 	return &RpcMessage{
-		Version: "2.0",
+		Version: ProtocolVersion,
 		Method:  method,
 		Params:  params,
 	}
 }
 
-func MakeResult(id uint64, result any) *RpcMessage {
+// MakeNamedNotify makes a notification with params passed by name.
+func MakeNamedNotify(method string, params map[string]any) *RpcMessage {
+	return &RpcMessage{
+		Version:     ProtocolVersion,
+		Method:      method,
+		NamedParams: params,
+	}
+}
+
+// makeErrorReply makes an error answering the request with the given id.
+func makeErrorReply(id Id, code ErrorCode, message string) *RpcMessage {
+	msg := MakeError(code, message, nil)
+	msg.Id = id
+	return msg
+}
+
+func MakeResult(id Id, result any) *RpcMessage {
 	return &RpcMessage{
-		Version: "2.0",
+		Version: ProtocolVersion,
 		Id:      id,
 		Result:  result,
 	}
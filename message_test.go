@@ -1,15 +1,16 @@
 package jsonrpc
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestMakeCall(t *testing.T) {
-	msg := MakeCall(1, "test", []any{1, 2, 3})
+	msg := MakeCall(NumberId(1), "test", []any{1, 2, 3})
 	assert.Equal(t, msg.Version, "2.0")
-	assert.Equal(t, msg.Id, uint64(1))
+	assert.Equal(t, msg.Id, NumberId(1))
 	assert.Equal(t, msg.Method, "test")
 	assert.Equal(t, msg.Params, []any{1, 2, 3})
 	assert.Nil(t, msg.Error, nil)
@@ -26,7 +27,7 @@ func TestMakeNotify(t *testing.T) {
 	assert.Equal(t, msg.Version, "2.0")
 	assert.Equal(t, msg.Method, "test")
 	assert.Equal(t, msg.Params, []any{1, 2, 3})
-	assert.Equal(t, msg.Id, uint64(0))
+	assert.True(t, msg.Id.IsZero())
 	assert.Nil(t, msg.Error, nil)
 	assert.Nil(t, msg.Result, nil)
 	assert.False(t, msg.IsCall())
@@ -51,9 +52,9 @@ func TestMakeError(t *testing.T) {
 
 // test make result
 func TestMakeResult(t *testing.T) {
-	msg := MakeResult(1, "test")
+	msg := MakeResult(NumberId(1), "test")
 	assert.Equal(t, msg.Version, "2.0")
-	assert.Equal(t, msg.Id, uint64(1))
+	assert.Equal(t, msg.Id, NumberId(1))
 	assert.Equal(t, msg.Result, "test")
 	assert.Nil(t, msg.Error, nil)
 	assert.Nil(t, msg.Params, nil)
@@ -62,3 +63,61 @@ func TestMakeResult(t *testing.T) {
 	assert.False(t, msg.IsError())
 	assert.True(t, msg.IsResult())
 }
+
+func TestMarshalMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *RpcMessage
+		json string
+	}{
+		{"call", MakeCall(NumberId(1), "add", []any{1, 2}), `{"jsonrpc":"2.0","id":1,"method":"add","params":[1,2]}`},
+		{"call without params", MakeCall(StringId("a"), "ping", nil), `{"jsonrpc":"2.0","id":"a","method":"ping"}`},
+		{"named call", MakeNamedCall(NumberId(1), "sub", map[string]any{"a": 1}), `{"jsonrpc":"2.0","id":1,"method":"sub","params":{"a":1}}`},
+		{"notify", MakeNotify("update", []any{1}), `{"jsonrpc":"2.0","method":"update","params":[1]}`},
+		{"named notify", MakeNamedNotify("update", map[string]any{}), `{"jsonrpc":"2.0","method":"update","params":{}}`},
+		{"result", MakeResult(NumberId(2), 3), `{"jsonrpc":"2.0","id":2,"result":3}`},
+		{"null result", MakeResult(NumberId(2), nil), `{"jsonrpc":"2.0","id":2,"result":null}`},
+		{"error", MakeError(ErrorCodeParse, "Parse error", nil), `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"Parse error"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.msg)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.json, string(data))
+		})
+	}
+}
+
+func TestUnmarshalMessage(t *testing.T) {
+	msg := &RpcMessage{}
+	err := json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":"abc","method":"test","params":[1]}`), msg)
+	assert.NoError(t, err)
+	assert.Equal(t, StringId("abc"), msg.Id)
+	assert.True(t, msg.IsCall())
+
+	msg = &RpcMessage{}
+	err = json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid Request"}}`), msg)
+	assert.NoError(t, err)
+	assert.True(t, msg.Id.IsNull())
+	assert.False(t, msg.Id.IsZero())
+	assert.True(t, msg.IsError())
+
+	msg = &RpcMessage{}
+	err = json.Unmarshal([]byte(`{"jsonrpc":"2.0","method":"test"}`), msg)
+	assert.NoError(t, err)
+	assert.True(t, msg.IsNotify())
+
+	msg = &RpcMessage{}
+	err = json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":1,"method":"test","params":{"a":1}}`), msg)
+	assert.NoError(t, err)
+	assert.Nil(t, msg.Params)
+	assert.Equal(t, map[string]any{"a": 1.0}, msg.NamedParams)
+
+	msg = &RpcMessage{}
+	err = json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":1,"method":"test","params":"bar"}`), msg)
+	assert.Error(t, err)
+
+	msg = &RpcMessage{}
+	err = json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":{},"method":"test"}`), msg)
+	assert.Error(t, err)
+}
@@ -1,46 +1,255 @@
 package jsonrpc
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrMethodNotFound is returned when calling a method which is not registered.
+	ErrMethodNotFound = errors.New("method not found")
+	// ErrInvalidParams is returned when the params do not match the method.
+	ErrInvalidParams = errors.New("invalid params")
 )
 
 type MethodHandle func(params []any) (any, error)
 
+// NamedMethodHandle handles a call with params passed by name.
+type NamedMethodHandle func(params map[string]any) (any, error)
+
+// ContextMethodHandle handles a call with params passed by position. The
+// context tells about the call, see ConnectionFromContext and friends.
+type ContextMethodHandle func(ctx context.Context, params []any) (any, error)
+
+// method holds the handles of a method, one per params shape it accepts.
+type method struct {
+	call      func(ctx context.Context, params []any) (any, error)
+	callNamed func(ctx context.Context, params map[string]any) (any, error)
+}
+
+// Methods is the method registry. Lookups read an immutable snapshot of
+// the registered methods, changes publish a modified copy. Handlers thus
+// run in parallel and may change the registry themselves.
+// The zero value is an empty registry.
 type Methods struct {
-	mutex   sync.Mutex
-	methods map[string]MethodHandle
+	// mutex serializes changes
+	mutex       sync.Mutex
+	methods     atomic.Value
+	naming      NamingConvention
+	middlewares []Middleware
+	// handler is the call handler wrapped by the middlewares
+	handler atomic.Value
 }
 
 func NewRegistry() *Methods {
-	return &Methods{
-		methods: make(map[string]MethodHandle),
+	return &Methods{}
+}
+
+// snapshot returns the registered methods. The map must not be modified.
+func (r *Methods) snapshot() map[string]method {
+	methods, _ := r.methods.Load().(map[string]method)
+	return methods
+}
+
+// update applies the change to a copy of the registered methods and
+// publishes the copy.
+func (r *Methods) update(change func(methods map[string]method)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	old := r.snapshot()
+	methods := make(map[string]method, len(old)+1)
+	for name, m := range old {
+		methods[name] = m
 	}
+	change(methods)
+	r.methods.Store(methods)
 }
 
+// RegisterMethod registers a handle for calls with params passed by position.
 func (r *Methods) RegisterMethod(name string, handle MethodHandle) {
+	r.update(func(methods map[string]method) {
+		m := methods[name]
+		m.call = func(ctx context.Context, params []any) (any, error) {
+			return handle(params)
+		}
+		methods[name] = m
+	})
+}
+
+// RegisterNamedMethod registers a handle for calls with params passed by name.
+// A method can have both a positional and a named handle.
+func (r *Methods) RegisterNamedMethod(name string, handle NamedMethodHandle) {
+	r.update(func(methods map[string]method) {
+		m := methods[name]
+		m.callNamed = func(ctx context.Context, params map[string]any) (any, error) {
+			return handle(params)
+		}
+		methods[name] = m
+	})
+}
+
+// RegisterContextMethod registers a handle receiving the context of the call
+// for calls with params passed by position.
+func (r *Methods) RegisterContextMethod(name string, handle ContextMethodHandle) {
+	r.update(func(methods map[string]method) {
+		m := methods[name]
+		m.call = handle
+		methods[name] = m
+	})
+}
+
+// Register registers an ordinary Go function as method, for example
+// func(ctx context.Context, a, b int) (int, error). The context argument is
+// optional. Params passed by position are decoded into the arguments in
+// order, params passed by name are decoded into the single argument.
+func (r *Methods) Register(name string, fn any) error {
+	switch handle := fn.(type) {
+	case MethodHandle:
+		r.RegisterMethod(name, handle)
+		return nil
+	case func(params []any) (any, error):
+		r.RegisterMethod(name, handle)
+		return nil
+	case ContextMethodHandle:
+		r.RegisterContextMethod(name, handle)
+		return nil
+	case func(ctx context.Context, params []any) (any, error):
+		r.RegisterContextMethod(name, handle)
+		return nil
+	case NamedMethodHandle:
+		r.RegisterNamedMethod(name, handle)
+		return nil
+	case func(params map[string]any) (any, error):
+		r.RegisterNamedMethod(name, handle)
+		return nil
+	}
+	h, err := newFuncHandler(fn)
+	if err != nil {
+		return err
+	}
+	r.update(func(methods map[string]method) {
+		methods[name] = h.method()
+	})
+	return nil
+}
+
+// SetNamingConvention sets how RegisterService derives method names.
+// The default is LowerCamelCase.
+func (r *Methods) SetNamingConvention(naming NamingConvention) {
 	r.mutex.Lock()
-	r.methods[name] = handle
+	r.naming = naming
 	r.mutex.Unlock()
 }
 
+// RegisterService registers the exported methods of service as
+// "namespace.method" using the naming convention, so the method Add of
+// a service registered as "calc" becomes "calc.add". Methods with
+// a signature not accepted by Register are skipped.
+func (r *Methods) RegisterService(namespace string, service any) error {
+	v := reflect.ValueOf(service)
+	if !v.IsValid() {
+		return fmt.Errorf("jsonrpc: service %s is nil", namespace)
+	}
+	t := v.Type()
+	handlers := make(map[string]*funcHandler)
+	for i := 0; i < t.NumMethod(); i++ {
+		h, err := newFuncHandler(v.Method(i).Interface())
+		if err != nil {
+			continue
+		}
+		handlers[t.Method(i).Name] = h
+	}
+	if len(handlers) == 0 {
+		return fmt.Errorf("jsonrpc: %s has no methods to register", t)
+	}
+	r.update(func(methods map[string]method) {
+		naming := r.naming
+		if naming == nil {
+			naming = LowerCamelCase
+		}
+		for name, h := range handlers {
+			methods[namespace+"."+naming(name)] = h.method()
+		}
+	})
+	return nil
+}
+
+// UnregisterService unregisters all methods within the namespace.
+func (r *Methods) UnregisterService(namespace string) {
+	prefix := namespace + "."
+	r.update(func(methods map[string]method) {
+		for name := range methods {
+			if strings.HasPrefix(name, prefix) {
+				delete(methods, name)
+			}
+		}
+	})
+}
+
 func (r *Methods) UnregisterMethod(name string) {
-	r.mutex.Lock()
-	delete(r.methods, name)
-	r.mutex.Unlock()
+	r.update(func(methods map[string]method) {
+		delete(methods, name)
+	})
 }
 
 func (r *Methods) GetMethod(name string) MethodHandle {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	return r.methods[name]
+	call := r.snapshot()[name].call
+	if call == nil {
+		return nil
+	}
+	return func(params []any) (any, error) {
+		return call(context.Background(), params)
+	}
 }
 
-func (r *Methods) CallMethod(name string, params []any) (any, error) {
+// Use appends middlewares run around every method call. The first
+// middleware is the outermost.
+func (r *Methods) Use(middlewares ...Middleware) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	if r.methods[name] == nil {
-		return nil, fmt.Errorf("method %s not found", name)
+	r.middlewares = append(r.middlewares, middlewares...)
+	r.handler.Store(chain(r.handle, r.middlewares))
+}
+
+// CallMethod calls a method with params passed by position. The context
+// is passed on to handles accepting one.
+func (r *Methods) CallMethod(ctx context.Context, name string, params []any) (any, error) {
+	return r.invoke(ctx, &RpcMessage{Version: ProtocolVersion, Method: name, Params: params})
+}
+
+// CallNamedMethod calls a method with params passed by name.
+func (r *Methods) CallNamedMethod(ctx context.Context, name string, params map[string]any) (any, error) {
+	return r.invoke(ctx, &RpcMessage{Version: ProtocolVersion, Method: name, NamedParams: params})
+}
+
+// invoke runs the call through the middlewares to the method.
+func (r *Methods) invoke(ctx context.Context, msg *RpcMessage) (any, error) {
+	handler, ok := r.handler.Load().(CallHandler)
+	if !ok {
+		handler = r.handle
+	}
+	return handler(ctx, msg)
+}
+
+// handle calls the method with params passed by position or by name.
+func (r *Methods) handle(ctx context.Context, msg *RpcMessage) (any, error) {
+	m, ok := r.snapshot()[msg.Method]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMethodNotFound, msg.Method)
+	}
+	if msg.NamedParams != nil {
+		if m.callNamed == nil {
+			return nil, fmt.Errorf("%w: %s expects params by position", ErrInvalidParams, msg.Method)
+		}
+		return m.callNamed(ctx, msg.NamedParams)
+	}
+	if m.call == nil {
+		return nil, fmt.Errorf("%w: %s expects params by name", ErrInvalidParams, msg.Method)
 	}
-	return r.methods[name](params)
+	return m.call(ctx, msg.Params)
 }
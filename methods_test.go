@@ -1,7 +1,11 @@
 package jsonrpc
 
 import (
+	"context"
+	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -39,8 +43,134 @@ func TestCallMethod(t *testing.T) {
 		isCalled = true
 		return "test", nil
 	})
-	result, err := registry.CallMethod("test", []any{1, 2, 3})
+	result, err := registry.CallMethod(context.Background(), "test", []any{1, 2, 3})
 	assert.Nil(t, err)
 	assert.Equal(t, result, "test")
 	assert.True(t, isCalled)
 }
+
+// test call named method
+func TestCallNamedMethod(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterNamedMethod("test", func(params map[string]any) (any, error) {
+		return params["name"], nil
+	})
+	result, err := registry.CallNamedMethod(context.Background(), "test", map[string]any{"name": "test"})
+	assert.Nil(t, err)
+	assert.Equal(t, result, "test")
+	_, err = registry.CallMethod(context.Background(), "test", []any{"test"})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+	_, err = registry.CallNamedMethod(context.Background(), "missing", nil)
+	assert.ErrorIs(t, err, ErrMethodNotFound)
+}
+
+// test handler changing the registry
+func TestRegisterWithinHandler(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterMethod("install", func(params []any) (any, error) {
+		registry.RegisterMethod("installed", func(params []any) (any, error) {
+			return "installed", nil
+		})
+		registry.UnregisterMethod("install")
+		return nil, nil
+	})
+	_, err := registry.CallMethod(context.Background(), "install", nil)
+	assert.NoError(t, err)
+	result, err := registry.CallMethod(context.Background(), "installed", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "installed", result)
+	assert.Nil(t, registry.GetMethod("install"))
+}
+
+// test handlers run in parallel
+func TestCallMethodParallel(t *testing.T) {
+	registry := NewRegistry()
+	release := make(chan bool)
+	registry.RegisterMethod("wait", func(params []any) (any, error) {
+		<-release
+		return nil, nil
+	})
+	registry.RegisterMethod("echo", func(params []any) (any, error) {
+		return params[0], nil
+	})
+	go registry.CallMethod(context.Background(), "wait", nil)
+	result, err := registry.CallMethod(context.Background(), "echo", []any{"test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "test", result)
+	close(release)
+}
+
+// discardSender drops all messages
+type discardSender struct{}
+
+func (discardSender) SendMessage(msg *RpcMessage) error {
+	return nil
+}
+
+func (discardSender) SendBatch(msgs []*RpcMessage) error {
+	return nil
+}
+
+func BenchmarkCallMethod(b *testing.B) {
+	registry := NewRegistry()
+	registry.RegisterMethod("echo", func(params []any) (any, error) {
+		return params[0], nil
+	})
+	params := []any{"test"}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			registry.CallMethod(context.Background(), "echo", params)
+		}
+	})
+}
+
+// BenchmarkConnections measures calls handled per second by connections
+// sharing one registry. The handler waits shortly as if it did some I/O.
+func BenchmarkConnections(b *testing.B) {
+	registry := NewRegistry()
+	registry.RegisterMethod("io", func(params []any) (any, error) {
+		time.Sleep(50 * time.Microsecond)
+		return nil, nil
+	})
+	for _, conns := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("conns=%d", conns), func(b *testing.B) {
+			var seq uint64
+			b.SetParallelism(conns)
+			b.RunParallel(func(pb *testing.PB) {
+				p := NewProtocol(discardSender{}, registry)
+				for pb.Next() {
+					p.handleCall(MakeCall(NumberId(atomic.AddUint64(&seq, 1)), "io", nil))
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkCallMethodWhileRegistering measures lookups while the registry changes.
+func BenchmarkCallMethodWhileRegistering(b *testing.B) {
+	registry := NewRegistry()
+	registry.RegisterMethod("echo", func(params []any) (any, error) {
+		return params[0], nil
+	})
+	done := make(chan bool)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				registry.RegisterMethod(fmt.Sprintf("m%d", i%100), func(params []any) (any, error) {
+					return nil, nil
+				})
+			}
+		}
+	}()
+	defer close(done)
+	params := []any{"test"}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			registry.CallMethod(context.Background(), "echo", params)
+		}
+	})
+}
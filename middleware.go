@@ -0,0 +1,66 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// CallHandler handles a call described by its message. For incoming calls
+// it runs the method, for outgoing calls it sends the call and waits for
+// the result.
+type CallHandler func(ctx context.Context, msg *RpcMessage) (any, error)
+
+// Middleware wraps a call handler, e.g. to log, authorize or time calls.
+// A middleware may return without calling next to short-circuit the call.
+type Middleware func(next CallHandler) CallHandler
+
+// chain wraps the handler with the middlewares, the first being outermost.
+func chain(handler CallHandler, middlewares []Middleware) CallHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Recoverer turns a panic of the next handler into an ErrInternal error.
+func Recoverer(next CallHandler) CallHandler {
+	return func(ctx context.Context, msg *RpcMessage) (result any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("rpc: panic in %s: %v\n%s", msg.Method, r, debug.Stack())
+				result, err = nil, fmt.Errorf("%w: %s panicked", ErrInternal, msg.Method)
+			}
+		}()
+		return next(ctx, msg)
+	}
+}
+
+// Logger logs each call with its duration and outcome.
+func Logger(next CallHandler) CallHandler {
+	return func(ctx context.Context, msg *RpcMessage) (any, error) {
+		start := time.Now()
+		result, err := next(ctx, msg)
+		if err != nil {
+			log.Printf("rpc: %s %s failed in %v: %v", msg.Method, RequestIdFromContext(ctx), time.Since(start), err)
+		} else {
+			log.Printf("rpc: %s %s done in %v", msg.Method, RequestIdFromContext(ctx), time.Since(start))
+		}
+		return result, err
+	}
+}
+
+// Timing reports the duration and error of each call to observe,
+// e.g. to record metrics.
+func Timing(observe func(method string, duration time.Duration, err error)) Middleware {
+	return func(next CallHandler) CallHandler {
+		return func(ctx context.Context, msg *RpcMessage) (any, error) {
+			start := time.Now()
+			result, err := next(ctx, msg)
+			observe(msg.Method, time.Since(start), err)
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tracing(name string, trace *[]string) Middleware {
+	return func(next CallHandler) CallHandler {
+		return func(ctx context.Context, msg *RpcMessage) (any, error) {
+			*trace = append(*trace, name+">")
+			result, err := next(ctx, msg)
+			*trace = append(*trace, "<"+name)
+			return result, err
+		}
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	r := NewRegistry()
+	var trace []string
+	r.RegisterMethod("test", func(params []any) (any, error) {
+		trace = append(trace, "test")
+		return "ok", nil
+	})
+	r.Use(tracing("a", &trace), tracing("b", &trace))
+	result, err := r.CallMethod(context.Background(), "test", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", result)
+	assert.Equal(t, []string{"a>", "b>", "test", "<b", "<a"}, trace)
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	r := NewRegistry()
+	called := false
+	r.RegisterNamedMethod("secret", func(params map[string]any) (any, error) {
+		called = true
+		return nil, nil
+	})
+	denied := errors.New("denied")
+	r.Use(func(next CallHandler) CallHandler {
+		return func(ctx context.Context, msg *RpcMessage) (any, error) {
+			if msg.NamedParams["token"] != "valid" {
+				return nil, denied
+			}
+			return next(ctx, msg)
+		}
+	})
+	_, err := r.CallNamedMethod(context.Background(), "secret", map[string]any{"token": "forged"})
+	assert.ErrorIs(t, err, denied)
+	assert.False(t, called)
+	_, err = r.CallNamedMethod(context.Background(), "secret", map[string]any{"token": "valid"})
+	assert.Nil(t, err)
+	assert.True(t, called)
+}
+
+func TestRecovererAndTiming(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterMethod("panic", func(params []any) (any, error) {
+		panic("boom")
+	})
+	var method string
+	var observed error
+	r.Use(Timing(func(m string, d time.Duration, err error) {
+		method, observed = m, err
+	}), Recoverer)
+	_, err := r.CallMethod(context.Background(), "panic", nil)
+	assert.ErrorIs(t, err, ErrInternal)
+	assert.Equal(t, "panic", method)
+	assert.ErrorIs(t, observed, ErrInternal)
+}
+
+func TestMiddlewareMethodNotFound(t *testing.T) {
+	r := NewRegistry()
+	var trace []string
+	r.Use(tracing("a", &trace))
+	_, err := r.CallMethod(context.Background(), "missing", nil)
+	assert.ErrorIs(t, err, ErrMethodNotFound)
+	assert.Equal(t, []string{"a>", "<a"}, trace)
+}
+
+func TestOutboundMiddleware(t *testing.T) {
+	s := NewMockMessageSender()
+	p := NewProtocol(s, NewRegistry())
+	p.UseOutbound(func(next CallHandler) CallHandler {
+		return func(ctx context.Context, msg *RpcMessage) (any, error) {
+			msg.Params = append(msg.Params, "signed")
+			if msg.Method == "blocked" {
+				return nil, ErrInvalidParams
+			}
+			return next(ctx, msg)
+		}
+	})
+	_, err := p.SendCall("blocked", nil)
+	assert.ErrorIs(t, err, ErrInvalidParams)
+	assert.Equal(t, 0, len(s.Messages))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.CallContext(ctx, "test", []any{1})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []any{1, "signed"}, s.Messages[0].Params)
+}
+
+func TestOutboundMiddlewareBatch(t *testing.T) {
+	s := NewMockMessageSender()
+	p := NewProtocol(s, NewRegistry())
+	p.UseOutbound(func(next CallHandler) CallHandler {
+		return func(ctx context.Context, msg *RpcMessage) (any, error) {
+			msg.Params = append(msg.Params, "signed")
+			if msg.Method == "blocked" {
+				return nil, ErrInvalidParams
+			}
+			return next(ctx, msg)
+		}
+	})
+	batch := p.NewBatch()
+	blocked := batch.Call("blocked", nil)
+	batch.Notify("event", nil)
+	call := batch.Call("test", []any{1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, batch.SendContext(ctx))
+	assert.ErrorIs(t, blocked.Error, ErrInvalidParams)
+	assert.ErrorIs(t, call.Error, context.DeadlineExceeded)
+	assert.Equal(t, 1, len(s.Batches))
+	assert.Equal(t, 2, len(s.Batches[0]))
+	assert.Equal(t, "event", s.Batches[0][0].Method)
+	assert.Equal(t, []any{1, "signed"}, s.Batches[0][1].Params)
+}
@@ -0,0 +1,49 @@
+package jsonrpc
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NamingConvention converts the name of a Go method into a method name.
+type NamingConvention func(name string) string
+
+// LowerCamelCase converts "GetTotal" into "getTotal" and "HTTPStatus" into "httpStatus".
+func LowerCamelCase(name string) string {
+	runes := []rune(name)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	// keep the last capital of an acronym as start of the next word
+	if upper > 1 && upper < len(runes) {
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// SnakeCase converts "GetTotal" into "get_total" and "HTTPStatus" into "http_status".
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && !unicode.IsUpper(runes[i-1])
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || nextLower {
+				b.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ExactCase keeps the name of the Go method.
+func ExactCase(name string) string {
+	return name
+}
@@ -0,0 +1,97 @@
+package jsonrpc
+
+import (
+	"compress/flate"
+	"time"
+)
+
+const (
+	defaultReadLimit    = 1 << 20
+	defaultPongTimeout  = 60 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+	defaultBufferSize   = 1024
+	defaultSendQueue    = 16
+	defaultThreshold    = 256
+)
+
+// ConnectionOptions configures the limits and timeouts of a connection.
+// Zero values select the defaults.
+type ConnectionOptions struct {
+	// ReadLimit is the largest message accepted in bytes. A websocket
+	// receiving a larger message is closed with CloseMessageTooBig.
+	// Defaults to 1 MiB.
+	ReadLimit int64
+	// PingInterval is the period of pings sent to the peer. Intervals not
+	// less than PongTimeout would drop idle connections and are replaced by
+	// the default of nine tenths of PongTimeout.
+	PingInterval time.Duration
+	// PongTimeout is the time allowed to read the next pong or message
+	// from the peer. Defaults to 60 seconds.
+	PongTimeout time.Duration
+	// WriteTimeout is the time allowed to write a message. Defaults to
+	// 10 seconds.
+	WriteTimeout time.Duration
+	// ReadBufferSize and WriteBufferSize are the websocket I/O buffer
+	// sizes in bytes. They do not limit the message size. Default to 1024.
+	ReadBufferSize  int
+	WriteBufferSize int
+	// SendQueue is the number of messages queued for writing before
+	// senders block. Defaults to 16.
+	SendQueue int
+	// Compression negotiates permessage-deflate with the peer. It is only
+	// used if both sides enable it.
+	Compression bool
+	// CompressionLevel is the flate level of compressed messages, from
+	// flate.BestSpeed to flate.BestCompression. Defaults to flate.BestSpeed.
+	CompressionLevel int
+	// CompressionThreshold is the size in bytes below which messages are
+	// sent uncompressed. Defaults to 256.
+	CompressionThreshold int
+}
+
+// HubOptions configures a hub.
+type HubOptions struct {
+	// ConnectionOptions apply to every connection of the hub. The read
+	// limit applies to HTTP request bodies as well.
+	ConnectionOptions
+}
+
+// withDefaults returns the options with zero values set to the defaults.
+func (o ConnectionOptions) withDefaults() ConnectionOptions {
+	if o.ReadLimit <= 0 {
+		o.ReadLimit = defaultReadLimit
+	}
+	if o.PongTimeout <= 0 {
+		o.PongTimeout = defaultPongTimeout
+	}
+	if o.PingInterval <= 0 || o.PingInterval >= o.PongTimeout {
+		o.PingInterval = o.PongTimeout * 9 / 10
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = defaultWriteTimeout
+	}
+	if o.ReadBufferSize <= 0 {
+		o.ReadBufferSize = defaultBufferSize
+	}
+	if o.WriteBufferSize <= 0 {
+		o.WriteBufferSize = defaultBufferSize
+	}
+	if o.SendQueue <= 0 {
+		o.SendQueue = defaultSendQueue
+	}
+	if o.CompressionLevel == 0 {
+		o.CompressionLevel = flate.BestSpeed
+	}
+	if o.CompressionThreshold <= 0 {
+		o.CompressionThreshold = defaultThreshold
+	}
+	return o
+}
+
+// connectionOptions returns the first options with defaults.
+func connectionOptions(opts []ConnectionOptions) ConnectionOptions {
+	if len(opts) == 0 {
+		return ConnectionOptions{}.withDefaults()
+	}
+	return opts[0].withDefaults()
+}
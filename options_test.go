@@ -0,0 +1,106 @@
+package jsonrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionOptionsDefaults(t *testing.T) {
+	opts := ConnectionOptions{}.withDefaults()
+	assert.Equal(t, int64(defaultReadLimit), opts.ReadLimit)
+	assert.Equal(t, 54*time.Second, opts.PingInterval)
+	assert.Equal(t, 60*time.Second, opts.PongTimeout)
+	assert.Equal(t, 10*time.Second, opts.WriteTimeout)
+	assert.Equal(t, 1024, opts.ReadBufferSize)
+	assert.Equal(t, 16, opts.SendQueue)
+
+	opts = ConnectionOptions{PongTimeout: 10 * time.Second, ReadLimit: 64}.withDefaults()
+	assert.Equal(t, 9*time.Second, opts.PingInterval)
+	assert.Equal(t, int64(64), opts.ReadLimit)
+
+	opts = ConnectionOptions{PongTimeout: 10 * time.Second, PingInterval: 10 * time.Second}.withDefaults()
+	assert.Equal(t, 9*time.Second, opts.PingInterval)
+	opts = ConnectionOptions{PingInterval: 5 * time.Second}.withDefaults()
+	assert.Equal(t, 5*time.Second, opts.PingInterval)
+}
+
+func makeTestHubWithOptions(opts HubOptions) (*Hub, *httptest.Server) {
+	hub := NewHub(opts)
+	handler := NewRouter()
+	handler.Get("/ws", hub.HandleRequest)
+	handler.Post("/rpc", hub.HandlePost)
+	return hub, httptest.NewServer(handler)
+}
+
+func TestLargeMessage(t *testing.T) {
+	hub, ts := makeTestHub()
+	client, err := makeTestClient(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+	defer func() {
+		hub.RemoveAllConnections()
+		client.Close()
+		ts.Close()
+	}()
+	hub.RegisterMethod("echo", func(params []any) (any, error) {
+		return params[0], nil
+	})
+	payload := strings.Repeat("x", 64*1024)
+	result, err := client.Call("echo", []any{payload})
+	assert.NoError(t, err)
+	assert.Equal(t, payload, result)
+}
+
+func TestOversizeMessageCloses(t *testing.T) {
+	hub, ts := makeTestHubWithOptions(HubOptions{ConnectionOptions{ReadLimit: 64}})
+	defer func() {
+		hub.RemoveAllConnections()
+		ts.Close()
+	}()
+	ws, err := NewWebSocket(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+	defer ws.Close()
+	msg := MakeNotify("test", []any{strings.Repeat("x", 100)})
+	assert.NoError(t, ws.WriteJSON(msg))
+	_, _, err = ws.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	assert.True(t, ok, "expected close error, got %v", err)
+	if ok {
+		assert.Equal(t, websocket.CloseMessageTooBig, closeErr.Code)
+		assert.Equal(t, "message exceeds read limit of 64 bytes", closeErr.Text)
+	}
+}
+
+func TestOversizeReplyFailsCall(t *testing.T) {
+	hub, ts := makeTestHub()
+	defer func() {
+		hub.RemoveAllConnections()
+		ts.Close()
+	}()
+	hub.RegisterMethod("big", func(params []any) (any, error) {
+		return strings.Repeat("x", 1000), nil
+	})
+	ws, err := NewWebSocket(HttpToWsAddr(ts.URL))
+	assert.NoError(t, err)
+	client := NewRpcClient(ws, ConnectionOptions{ReadLimit: 512})
+	_, err = client.Call("big", nil)
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+}
+
+func TestOversizeBody(t *testing.T) {
+	hub, ts := makeTestHubWithOptions(HubOptions{ConnectionOptions{ReadLimit: 64}})
+	defer ts.Close()
+	hub.RegisterMethod("test", func(params []any) (any, error) {
+		return nil, nil
+	})
+	body := `{"jsonrpc":"2.0","method":"test","params":["` + strings.Repeat("x", 100) + `"],"id":1}`
+	resp, err := http.Post(ts.URL+"/rpc", "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
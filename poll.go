@@ -0,0 +1,312 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// Time a poll is held open while there are no messages.
+	pollTimeout = 25 * time.Second
+	// Time a session is kept without being polled.
+	sessionTimeout = 2 * pollTimeout
+)
+
+// pollTransport queues the messages of a long-polling client. Messages
+// posted by the client are read, written messages wait for the next poll.
+type pollTransport struct {
+	id     string
+	in     chan []byte
+	mutex  sync.Mutex
+	outbox []json.RawMessage
+	// limit is the most messages kept for the next poll
+	limit     int
+	ready     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	expire    *time.Timer
+	onClose   func()
+}
+
+func newPollTransport(id string, limit int, onClose func()) *pollTransport {
+	t := &pollTransport{
+		id:      id,
+		limit:   limit,
+		in:      make(chan []byte),
+		ready:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		onClose: onClose,
+	}
+	t.expire = time.AfterFunc(sessionTimeout, func() {
+		t.Close()
+	})
+	return t
+}
+
+func (t *pollTransport) ReadMessage() ([]byte, error) {
+	select {
+	case data := <-t.in:
+		return data, nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+func (t *pollTransport) WriteMessage(data []byte) error {
+	t.mutex.Lock()
+	if len(t.outbox) >= t.limit {
+		t.mutex.Unlock()
+		return fmt.Errorf("jsonrpc: session %s has more than %d messages waiting for a poll", t.id, t.limit)
+	}
+	t.outbox = append(t.outbox, data)
+	t.mutex.Unlock()
+	select {
+	case t.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (t *pollTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.expire.Stop()
+		t.onClose()
+	})
+	return nil
+}
+
+// post hands a message posted by the client to the connection.
+func (t *pollTransport) post(ctx context.Context, data []byte) error {
+	select {
+	case t.in <- data:
+		return nil
+	case <-t.done:
+		return ErrConnectionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// poll waits until there are messages for the client and takes them.
+// It returns no messages when the timeout passes first.
+func (t *pollTransport) poll(ctx context.Context, timeout time.Duration) []json.RawMessage {
+	t.expire.Stop()
+	defer t.expire.Reset(sessionTimeout)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		t.mutex.Lock()
+		msgs := t.outbox
+		t.outbox = nil
+		t.mutex.Unlock()
+		if len(msgs) > 0 {
+			return msgs
+		}
+		select {
+		case <-t.ready:
+		case <-timer.C:
+			return nil
+		case <-t.done:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// pollSessions keeps the sessions of long-polling clients.
+type pollSessions struct {
+	mutex    sync.Mutex
+	sessions map[string]*pollTransport
+}
+
+// open opens a session keeping up to limit messages for the next poll.
+func (s *pollSessions) open(limit int) *pollTransport {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	id := hex.EncodeToString(buf)
+	t := newPollTransport(id, limit, func() {
+		s.mutex.Lock()
+		delete(s.sessions, id)
+		s.mutex.Unlock()
+	})
+	s.mutex.Lock()
+	if s.sessions == nil {
+		s.sessions = make(map[string]*pollTransport)
+	}
+	s.sessions[id] = t
+	s.mutex.Unlock()
+	return t
+}
+
+func (s *pollSessions) get(id string) (*pollTransport, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	t, ok := s.sessions[id]
+	return t, ok
+}
+
+// HandlePoll serves clients which cannot hold a websocket or event stream
+// by long polling. Each session runs as a connection of the hub:
+//   - GET without session opens a session and answers {"session": id}
+//   - GET ?session=id waits for messages and answers them as JSON array,
+//     or 204 No Content when there are none before the poll times out
+//   - POST ?session=id hands the posted message or batch to the connection
+//   - DELETE ?session=id closes the session
+//
+// Sessions not polled for a while or collecting more messages than the send
+// queue holds are closed.
+func (h *Hub) HandlePoll(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("session")
+	if id == "" && r.Method == http.MethodGet {
+		t := h.polls.open(h.opts.SendQueue)
+		c := newConnection(requestContext(r), t, JSONCodec, &h.Methods, h, h.dispatch, h.opts.ConnectionOptions)
+		h.AddConnection(c)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"session": t.id})
+		return
+	}
+	t, ok := h.polls.get(id)
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		msgs := t.poll(r.Context(), pollTimeout)
+		if len(msgs) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(msgs)
+	case http.MethodPost:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.opts.ReadLimit))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		err = t.post(r.Context(), data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodDelete:
+		t.Close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// pollClient is the client side of a long-polling session.
+type pollClient struct {
+	url     string
+	pending []json.RawMessage
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// NewPollingTransport opens a long-polling session with the endpoint
+// served by HandlePoll at url, e.g. to run it with NewTransportClient.
+func NewPollingTransport(endpoint string) (Transport, error) {
+	resp, err := http.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("jsonrpc: http status %s", resp.Status)
+	}
+	var session struct {
+		Session string `json:"session"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&session)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("session", session.Session)
+	u.RawQuery = query.Encode()
+	c := &pollClient{url: u.String()}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+func (c *pollClient) ReadMessage() ([]byte, error) {
+	for len(c.pending) == 0 {
+		err := c.poll()
+		if err != nil {
+			return nil, io.EOF
+		}
+	}
+	data := c.pending[0]
+	c.pending = c.pending[1:]
+	return data, nil
+}
+
+func (c *pollClient) poll() error {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusOK:
+		return json.NewDecoder(resp.Body).Decode(&c.pending)
+	}
+	return fmt.Errorf("jsonrpc: http status %s", resp.Status)
+}
+
+func (c *pollClient) WriteMessage(data []byte) error {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("jsonrpc: http status %s", resp.Status)
+	}
+	return nil
+}
+
+func (c *pollClient) Close() error {
+	c.cancel()
+	req, err := http.NewRequest(http.MethodDelete, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
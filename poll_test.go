@@ -0,0 +1,101 @@
+package jsonrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLongPolling(t *testing.T) {
+	hub := NewHub()
+	handler := NewRouter()
+	handler.HandleFunc("/poll", hub.HandlePoll)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	hub.RegisterContextMethod("greet", func(ctx context.Context, params []any) (any, error) {
+		// call back the client which called
+		return ConnectionFromContext(ctx).CallContext(ctx, "name", nil)
+	})
+	transport, err := NewPollingTransport(ts.URL + "/poll")
+	assert.NoError(t, err)
+	client := NewTransportClient(transport)
+	client.RegisterMethod("name", func(params []any) (any, error) {
+		return "bob", nil
+	})
+	notified := make(chan bool, 1)
+	client.RegisterMethod("news", func(params []any) (any, error) {
+		notified <- true
+		return nil, nil
+	})
+
+	result, err := client.Call("greet", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", result)
+
+	hub.Notify("news", nil)
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("notification not polled")
+	}
+
+	client.Close()
+	assert.Eventually(t, func() bool {
+		hub.polls.mutex.Lock()
+		defer hub.polls.mutex.Unlock()
+		return len(hub.polls.sessions) == 0
+	}, time.Second, 10*time.Millisecond)
+	resp, err := http.Get(ts.URL + "/poll?session=unknown")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPollTimeout(t *testing.T) {
+	closed := make(chan bool, 1)
+	transport := newPollTransport("test", 2, func() {
+		closed <- true
+	})
+	start := time.Now()
+	assert.Empty(t, transport.poll(context.Background(), 20*time.Millisecond))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	assert.NoError(t, transport.WriteMessage([]byte(`{"a":1}`)))
+	assert.NoError(t, transport.WriteMessage([]byte(`{"b":2}`)))
+	assert.Error(t, transport.WriteMessage([]byte(`{"c":3}`)))
+	msgs := transport.poll(context.Background(), time.Second)
+	assert.Equal(t, 2, len(msgs))
+
+	transport.Close()
+	assert.True(t, <-closed)
+	_, err := transport.ReadMessage()
+	assert.Error(t, err)
+}
+
+func TestPollOutboxLimit(t *testing.T) {
+	hub := NewHub(HubOptions{ConnectionOptions{SendQueue: 4}})
+	handler := NewRouter()
+	handler.HandleFunc("/poll", hub.HandlePoll)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/poll")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// the session is never polled
+	for i := 0; i < 16; i++ {
+		hub.Notify("news", []any{i})
+	}
+	assert.Eventually(t, func() bool {
+		hub.polls.mutex.Lock()
+		defer hub.polls.mutex.Unlock()
+		return len(hub.polls.sessions) == 0
+	}, time.Second, 10*time.Millisecond)
+}
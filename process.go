@@ -0,0 +1,280 @@
+package jsonrpc
+
+import (
+	"context"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// killWait is the time a process is given to exit after its stdin is
+// closed before it is killed.
+const killWait = time.Second
+
+// ProcessOptions configures a process client.
+type ProcessOptions struct {
+	// Transport frames the messages on stdin and stdout of the process.
+	// Defaults to NewFramedTransport.
+	Transport func(rwc io.ReadWriteCloser) Transport
+	// Restart starts the process again when it exits on its own.
+	Restart bool
+	// MaxRestarts limits the restarts, zero is no limit.
+	MaxRestarts int
+	// RestartDelay is the time to wait before a restart.
+	RestartDelay time.Duration
+	// Command creates the command of each run instead of copying the
+	// template, e.g. to set fields which cannot be copied like the context
+	// of exec.CommandContext.
+	Command func() *exec.Cmd
+}
+
+// ProcessClient talks to a child process over its stdin and stdout. The
+// process lives as long as the client, calls pending when it exits fail
+// with ErrConnectionClosed. Methods registered on the client are served
+// to every run of the process.
+type ProcessClient struct {
+	*Methods
+	cmd      *exec.Cmd
+	opts     ProcessOptions
+	mutex    sync.Mutex
+	client   *RpcClient
+	process  *exec.Cmd
+	exited   chan struct{}
+	restarts int
+	closed   bool
+	done     chan struct{}
+	err      error
+}
+
+// NewProcessClient starts the command and connects a client to it.
+func NewProcessClient(cmd *exec.Cmd) (*ProcessClient, error) {
+	return NewProcessClientWithOptions(cmd, ProcessOptions{})
+}
+
+// NewProcessClientWithOptions starts the command and connects a client to
+// it, restarting it on exit if configured. The command serves as template
+// for every run and is not run itself: its path, args, environment,
+// directory, stderr, extra files and process attributes are copied. Other
+// fields need ProcessOptions.Command, in which case the command may be nil.
+func NewProcessClientWithOptions(cmd *exec.Cmd, opts ProcessOptions) (*ProcessClient, error) {
+	if opts.Transport == nil {
+		opts.Transport = NewFramedTransport
+	}
+	p := &ProcessClient{
+		Methods: NewRegistry(),
+		cmd:     cmd,
+		opts:    opts,
+		done:    make(chan struct{}),
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	err := p.start()
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// processStream joins the pipes to the stdin and stdout of a process.
+type processStream struct {
+	io.ReadCloser
+	stdin io.WriteCloser
+}
+
+func (s processStream) Write(data []byte) (int, error) {
+	return s.stdin.Write(data)
+}
+
+func (s processStream) Close() error {
+	err := s.stdin.Close()
+	s.ReadCloser.Close()
+	return err
+}
+
+// start runs a copy of the command. The mutex must be held.
+func (p *ProcessClient) start() error {
+	var cmd *exec.Cmd
+	if p.opts.Command != nil {
+		cmd = p.opts.Command()
+	} else {
+		cmd = copyCommand(p.cmd)
+	}
+	stream, err := startProcess(cmd)
+	if err != nil {
+		return err
+	}
+	client := newClient(p.opts.Transport(stream), p.Methods)
+	exited := make(chan struct{})
+	p.client, p.process, p.exited = client, cmd, exited
+	go p.watch(client, cmd, exited)
+	return nil
+}
+
+// copyCommand returns an unstarted copy of the command.
+func copyCommand(cmd *exec.Cmd) *exec.Cmd {
+	args := cmd.Args
+	if len(args) == 0 {
+		args = []string{cmd.Path}
+	}
+	return &exec.Cmd{
+		Path:        cmd.Path,
+		Args:        args,
+		Env:         cmd.Env,
+		Dir:         cmd.Dir,
+		Stderr:      cmd.Stderr,
+		ExtraFiles:  cmd.ExtraFiles,
+		SysProcAttr: cmd.SysProcAttr,
+	}
+}
+
+// startProcess starts the command with pipes to its stdin and stdout.
+func startProcess(cmd *exec.Cmd) (io.ReadWriteCloser, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	return processStream{stdout, stdin}, nil
+}
+
+// processTransport stops the process when it is closed.
+type processTransport struct {
+	Transport
+	cmd       *exec.Cmd
+	closeOnce sync.Once
+}
+
+// NewProcessTransport starts the command and returns a transport to its
+// stdin and stdout, framed by the framing function, e.g. NewFramedTransport.
+// Closing the transport closes stdin and waits for the process to exit,
+// killing it if it does not exit in time.
+func NewProcessTransport(cmd *exec.Cmd, framing func(rwc io.ReadWriteCloser) Transport) (Transport, error) {
+	stream, err := startProcess(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return &processTransport{Transport: framing(stream), cmd: cmd}, nil
+}
+
+func (t *processTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		err = t.Transport.Close()
+		exited := make(chan struct{})
+		go func() {
+			t.cmd.Wait()
+			close(exited)
+		}()
+		select {
+		case <-exited:
+		case <-time.After(killWait):
+			t.cmd.Process.Kill()
+			<-exited
+		}
+	})
+	return err
+}
+
+// watch waits for the process to exit and restarts it if configured.
+func (p *ProcessClient) watch(client *RpcClient, cmd *exec.Cmd, exited chan struct{}) {
+	// stdout must be read to the end before waiting
+	<-client.Conn.Context().Done()
+	err := cmd.Wait()
+	close(exited)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.err = err
+	if p.closed {
+		return
+	}
+	if !p.opts.Restart || (p.opts.MaxRestarts > 0 && p.restarts >= p.opts.MaxRestarts) {
+		p.closed = true
+		close(p.done)
+		return
+	}
+	p.restarts++
+	log.Printf("process %s exited: %v, restarting", cmd.Path, err)
+	p.mutex.Unlock()
+	time.Sleep(p.opts.RestartDelay)
+	p.mutex.Lock()
+	if p.closed {
+		return
+	}
+	err = p.start()
+	if err != nil {
+		log.Printf("error: %v", err)
+		p.err = err
+		p.closed = true
+		close(p.done)
+	}
+}
+
+// Client returns the client of the current run of the process.
+func (p *ProcessClient) Client() *RpcClient {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.client
+}
+
+// Done is closed once the process exited and is not restarted.
+func (p *ProcessClient) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the error the process last exited with.
+func (p *ProcessClient) Err() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.err
+}
+
+// Close closes the connection and stops the process, killing it if it
+// does not exit after its stdin is closed.
+func (p *ProcessClient) Close() {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	client, process, exited := p.client, p.process, p.exited
+	p.mutex.Unlock()
+	client.Close()
+	select {
+	case <-exited:
+	case <-time.After(killWait):
+		process.Process.Kill()
+		<-exited
+	}
+}
+
+// Call sends a request to the process and waits for a response.
+func (p *ProcessClient) Call(method string, params []any) (any, error) {
+	return p.Client().Call(method, params)
+}
+
+// CallContext sends a request to the process and waits for a response
+// until the context is done.
+func (p *ProcessClient) CallContext(ctx context.Context, method string, params []any) (any, error) {
+	return p.Client().CallContext(ctx, method, params)
+}
+
+// CallNamed sends a request with params passed by name and waits for a response.
+func (p *ProcessClient) CallNamed(method string, params any) (any, error) {
+	return p.Client().CallNamed(method, params)
+}
+
+// Notify sends a notification to the process.
+func (p *ProcessClient) Notify(method string, params []any) error {
+	return p.Client().Notify(method, params)
+}
@@ -0,0 +1,125 @@
+package jsonrpc
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHelperProcess is run as child process by the process client tests.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("JSONRPC_HELPER_PROCESS") != "1" {
+		t.Skip("helper process")
+	}
+	client := NewTransportClient(NewFramedTransport(Stdio()))
+	client.RegisterMethod("pid", func(params []any) (any, error) {
+		return os.Getpid(), nil
+	})
+	client.RegisterMethod("crash", func(params []any) (any, error) {
+		os.Exit(3)
+		return nil, nil
+	})
+	client.RegisterMethod("callback", func(params []any) (any, error) {
+		return client.Call("hello", nil)
+	})
+	<-client.Conn.Context().Done()
+	os.Exit(0)
+}
+
+func helperCommand() *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = append(os.Environ(), "JSONRPC_HELPER_PROCESS=1")
+	return cmd
+}
+
+func TestProcessClient(t *testing.T) {
+	p, err := NewProcessClient(helperCommand())
+	assert.NoError(t, err)
+	p.RegisterMethod("hello", func(params []any) (any, error) {
+		return "world", nil
+	})
+	result, err := p.Call("callback", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "world", result)
+
+	_, err = p.Call("crash", nil)
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("process exit not noticed")
+	}
+	assert.Error(t, p.Err())
+	p.Close()
+}
+
+func TestProcessClientRestart(t *testing.T) {
+	p, err := NewProcessClientWithOptions(helperCommand(), ProcessOptions{
+		Restart:      true,
+		MaxRestarts:  1,
+		RestartDelay: 10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer p.Close()
+	first, err := p.Call("pid", nil)
+	assert.NoError(t, err)
+
+	_, err = p.Call("crash", nil)
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+	var second any
+	assert.Eventually(t, func() bool {
+		second, err = p.Call("pid", nil)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NotEqual(t, first, second)
+
+	// the restarts are used up
+	p.Call("crash", nil)
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("process restarted too often")
+	}
+}
+
+func TestProcessClientClose(t *testing.T) {
+	p, err := NewProcessClientWithOptions(helperCommand(), ProcessOptions{Restart: true})
+	assert.NoError(t, err)
+	_, err = p.Call("pid", nil)
+	assert.NoError(t, err)
+	p.Close()
+	<-p.Done()
+	_, err = p.Call("pid", nil)
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+}
+
+func TestProcessClientCommand(t *testing.T) {
+	runs := 0
+	p, err := NewProcessClientWithOptions(nil, ProcessOptions{
+		Restart: true,
+		Command: func() *exec.Cmd {
+			runs++
+			return helperCommand()
+		},
+	})
+	assert.NoError(t, err)
+	defer p.Close()
+	p.Call("crash", nil)
+	assert.Eventually(t, func() bool {
+		_, err = p.Call("pid", nil)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	p.mutex.Lock()
+	assert.Equal(t, 2, runs)
+	p.mutex.Unlock()
+}
+
+func TestCopyCommand(t *testing.T) {
+	files := []*os.File{os.Stdin}
+	cmd := copyCommand(&exec.Cmd{Path: "/bin/true", ExtraFiles: files})
+	assert.Equal(t, []string{"/bin/true"}, cmd.Args)
+	assert.Equal(t, files, cmd.ExtraFiles)
+}
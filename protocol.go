@@ -1,54 +1,117 @@
 package jsonrpc
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"sync"
 	"sync/atomic"
 )
 
+// ErrConnectionClosed is returned for calls which can not complete because
+// the connection was closed.
+var ErrConnectionClosed = errors.New("connection closed")
+
+// ErrInternal is returned for method calls which failed unexpectedly,
+// e.g. because the method panicked.
+var ErrInternal = errors.New("internal error")
+
+// CancelRequestMethod is the notification sent to cancel a call in flight.
+// Its params carry the id of the call to cancel.
+const CancelRequestMethod = "$/cancelRequest"
+
 type MethodCaller interface {
-	CallMethod(name string, params []any) (any, error)
+	CallMethod(ctx context.Context, name string, params []any) (any, error)
+	CallNamedMethod(ctx context.Context, name string, params map[string]any) (any, error)
 }
 
 type MessageSender interface {
 	SendMessage(msg *RpcMessage) error
+	SendBatch(msgs []*RpcMessage) error
+}
+
+// contextSender is a sender giving up on a message once the context is
+// done, e.g. while its send queue is full.
+type contextSender interface {
+	sendMessageContext(ctx context.Context, msg *RpcMessage) error
+	sendBatchContext(ctx context.Context, msgs []*RpcMessage) error
 }
 
+// PendingCall is a call waiting for its reply. Done receives the reply,
+// or nil when the call failed without one.
 type PendingCall struct {
 	Message *RpcMessage
 	Done    chan *RpcMessage
+	err     error
 }
 
 func NewPendingCall(msg *RpcMessage) *PendingCall {
 	return &PendingCall{
 		Message: msg,
-		Done:    make(chan *RpcMessage),
+		Done:    make(chan *RpcMessage, 1),
+	}
+}
+
+// fail completes the call without a reply.
+func (c *PendingCall) fail(err error) {
+	c.err = err
+	c.Done <- nil
+}
+
+// result converts the reply into the result or error of the call.
+func (c *PendingCall) result(reply *RpcMessage) (any, error) {
+	if reply == nil {
+		return nil, c.err
 	}
+	return replyResult(reply)
 }
 
 type Protocol struct {
-	seq     uint64
-	sender  MessageSender
-	caller  MethodCaller
-	mutex   sync.Mutex
-	pending map[uint64]*PendingCall
+	seq      uint64
+	sender   MessageSender
+	caller   MethodCaller
+	mutex    sync.Mutex
+	pending  map[Id]*PendingCall
+	inflight map[Id]*inflightCall
+	closed   bool
+	// dispatcher runs incoming requests, nil runs them as they are read
+	dispatcher *dispatcher
+	// outbound sends calls through the outbound middlewares
+	outbound    CallHandler
+	middlewares []Middleware
+	// ctx is the context handlers derive their context from
+	ctx context.Context
 }
 
 func NewProtocol(sender MessageSender, caller MethodCaller) *Protocol {
 	return &Protocol{
-		sender:  sender,
-		caller:  caller,
-		pending: make(map[uint64]*PendingCall),
+		sender:   sender,
+		caller:   caller,
+		pending:  make(map[Id]*PendingCall),
+		inflight: make(map[Id]*inflightCall),
+		ctx:      context.Background(),
 	}
 }
 
 func (p *Protocol) nextSeq() uint64 {
-	atomic.AddUint64(&p.seq, 1)
-	return p.seq
+	return atomic.AddUint64(&p.seq, 1)
 }
 
-func (p *Protocol) takePending(id uint64) (*PendingCall, bool) {
+// addPending registers calls waiting for a reply.
+func (p *Protocol) addPending(calls ...*PendingCall) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return ErrConnectionClosed
+	}
+	for _, call := range calls {
+		p.pending[call.Message.Id] = call
+	}
+	return nil
+}
+
+func (p *Protocol) takePending(id Id) (*PendingCall, bool) {
 	p.mutex.Lock()
 	call, ok := p.pending[id]
 	delete(p.pending, id)
@@ -59,45 +122,288 @@ func (p *Protocol) takePending(id uint64) (*PendingCall, bool) {
 	return call, true
 }
 
+// failPending fails all pending calls with the error, cancels the calls
+// in flight and rejects new calls.
+func (p *Protocol) failPending(err error) {
+	p.mutex.Lock()
+	pending := p.pending
+	p.pending = make(map[Id]*PendingCall)
+	for _, call := range p.inflight {
+		call.cancel()
+	}
+	p.closed = true
+	p.mutex.Unlock()
+	for _, call := range pending {
+		call.fail(err)
+	}
+}
+
+// inflightCall is a call accepted but not yet answered.
+type inflightCall struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// acceptCall tracks a call from the moment it is read, so that cancel
+// requests reach it while it waits for the dispatcher.
+func (p *Protocol) acceptCall(id Id) *inflightCall {
+	ctx, cancel := context.WithCancel(context.WithValue(p.ctx, requestIdKey, id))
+	call := &inflightCall{ctx: ctx, cancel: cancel}
+	p.mutex.Lock()
+	p.inflight[id] = call
+	p.mutex.Unlock()
+	return call
+}
+
+// startCall returns the context of the handler of an accepted call,
+// accepting it if needed, and the func ending the call.
+func (p *Protocol) startCall(id Id) (context.Context, context.CancelFunc) {
+	p.mutex.Lock()
+	call, ok := p.inflight[id]
+	p.mutex.Unlock()
+	if !ok {
+		call = p.acceptCall(id)
+	}
+	return call.ctx, func() {
+		p.mutex.Lock()
+		if p.inflight[id] == call {
+			delete(p.inflight, id)
+		}
+		p.mutex.Unlock()
+		call.cancel()
+	}
+}
+
+// cancelCall cancels the context of the call in flight with the given id.
+func (p *Protocol) cancelCall(id Id) {
+	p.mutex.Lock()
+	call, ok := p.inflight[id]
+	p.mutex.Unlock()
+	if ok {
+		call.cancel()
+	}
+}
+
+// handleData decodes a raw frame and handles the message or batch it carries.
+// Malformed frames are answered with a parse or invalid request error.
+func (p *Protocol) handleData(data []byte) {
+	if !json.Valid(data) {
+		p.SendMessage(MakeError(ErrorCodeParse, "Parse error", nil))
+		return
+	}
+	if isBatch(data) {
+		p.handleBatch(data)
+		return
+	}
+	msg := decodeMessage(data)
+	if isRequest(msg) {
+		if msg.IsCall() {
+			p.acceptCall(msg.Id)
+		}
+		p.run(func() {
+			p.handleMessage(msg)
+		})
+		return
+	}
+	p.handleMessage(msg)
+}
+
+// handleBatch handles each entry of a batch and answers all calls
+// with a single batch. A batch of notifications is not answered.
+func (p *Protocol) handleBatch(data []byte) {
+	var entries []json.RawMessage
+	err := json.Unmarshal(data, &entries)
+	if err != nil || len(entries) == 0 {
+		p.SendMessage(MakeError(ErrorCodeInvalidRequest, "Invalid Request", nil))
+		return
+	}
+	msgs := make([]*RpcMessage, 0, len(entries))
+	requests := false
+	for _, entry := range entries {
+		msg := decodeMessage(entry)
+		if msg.Version == ProtocolVersion && (msg.IsResult() || msg.IsError()) {
+			// replies complete pending calls right away
+			p.dispatch(msg)
+			continue
+		}
+		if isRequest(msg) {
+			requests = true
+			if msg.IsCall() {
+				p.acceptCall(msg.Id)
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return
+	}
+	handle := func() {
+		replies := make([]*RpcMessage, 0, len(msgs))
+		for _, msg := range msgs {
+			reply := p.dispatch(msg)
+			if reply != nil {
+				replies = append(replies, reply)
+			}
+		}
+		if len(replies) > 0 {
+			p.SendBatch(replies)
+		}
+	}
+	if requests {
+		p.run(handle)
+		return
+	}
+	handle()
+}
+
+// isRequest reports whether the message is a call or notification run by
+// the dispatcher. Cancel requests are handled right away, so they can reach
+// a call which is still running.
+func isRequest(msg *RpcMessage) bool {
+	return msg.Version == ProtocolVersion && msg.Method != "" && msg.Method != CancelRequestMethod
+}
+
+// run runs the request handling job on the dispatcher, or right away
+// when there is none.
+func (p *Protocol) run(job func()) {
+	p.mutex.Lock()
+	d := p.dispatcher
+	p.mutex.Unlock()
+	if d == nil {
+		job()
+		return
+	}
+	d.run(job)
+}
+
+// SetDispatch sets how incoming calls and notifications are run. Requests
+// accepted before keep running on the previous settings. Without dispatch
+// settings requests are handled as they are read.
+func (p *Protocol) SetDispatch(opts DispatchOptions) {
+	d := newDispatcher(opts)
+	p.mutex.Lock()
+	old := p.dispatcher
+	p.dispatcher = d
+	p.mutex.Unlock()
+	if old != nil {
+		old.stop(true)
+	}
+}
+
+// stopDispatch stops running requests which have not yet started.
+func (p *Protocol) stopDispatch() {
+	p.mutex.Lock()
+	d := p.dispatcher
+	p.mutex.Unlock()
+	if d != nil {
+		d.stop(false)
+	}
+}
+
 func (p *Protocol) handleMessage(msg *RpcMessage) {
+	reply := p.dispatch(msg)
+	if reply != nil {
+		p.SendMessage(reply)
+	}
+}
+
+// dispatch handles a single message and returns the reply to send, if any.
+func (p *Protocol) dispatch(msg *RpcMessage) *RpcMessage {
+	if msg.Version != ProtocolVersion {
+		return makeErrorReply(msg.Id, ErrorCodeInvalidRequest, "Invalid Request")
+	}
 	if msg.IsCall() {
-		p.handleCall(msg)
+		return p.handleCall(msg)
 	} else if msg.IsNotify() {
 		p.handleNotify(msg)
 	} else if msg.IsResult() {
 		p.handleResult(msg)
 	} else if msg.IsError() {
 		p.handleError(msg)
+	} else {
+		return makeErrorReply(msg.Id, ErrorCodeInvalidRequest, "Invalid Request")
 	}
+	return nil
 }
 
-func (p *Protocol) handleCall(msg *RpcMessage) {
-	result, err := p.caller.CallMethod(msg.Method, msg.Params)
+func (p *Protocol) handleCall(msg *RpcMessage) *RpcMessage {
+	ctx, done := p.startCall(msg.Id)
+	defer done()
+	if ctx.Err() != nil {
+		// cancelled while queued
+		return makeErrorReply(msg.Id, ErrorCodeRequestCancelled, "Request cancelled")
+	}
+	result, err := p.callMethod(ctx, msg)
+	if ctx.Err() != nil {
+		return makeErrorReply(msg.Id, ErrorCodeRequestCancelled, "Request cancelled")
+	}
 	if err != nil {
-		p.SendMessage(MakeError(ErrorCodeMethodNotFound, err.Error(), err))
-		return
+		return &RpcMessage{
+			Version: ProtocolVersion,
+			Id:      msg.Id,
+			Error:   toRpcError(err),
+		}
 	}
-	p.SendMessage(MakeResult(msg.Id, result))
+	return MakeResult(msg.Id, result)
 }
 
 func (p *Protocol) handleNotify(msg *RpcMessage) {
-	_, err := p.caller.CallMethod(msg.Method, msg.Params)
+	if msg.Method == CancelRequestMethod {
+		p.handleCancel(msg)
+		return
+	}
+	// notifications are never answered, not even with an error
+	_, err := p.callMethod(p.ctx, msg)
 	if err != nil {
-		p.SendMessage(MakeError(ErrorCodeMethodNotFound, err.Error(), err))
+		log.Printf("rpc: notify %s: %v", msg.Method, err)
 	}
 }
 
+// handleCancel cancels the call in flight named by the cancel request.
+func (p *Protocol) handleCancel(msg *RpcMessage) {
+	var param any
+	if msg.NamedParams != nil {
+		param = msg.NamedParams["id"]
+	} else if len(msg.Params) > 0 {
+		param = msg.Params[0]
+	}
+	data, err := json.Marshal(param)
+	if err != nil {
+		return
+	}
+	id := Id{}
+	if err := id.UnmarshalJSON(data); err != nil || id.IsNull() {
+		log.Printf("rpc: invalid cancel request: %s", data)
+		return
+	}
+	p.cancelCall(id)
+}
+
+// callMethod calls the method with params passed by position or by name.
+// A panicking method fails with ErrInternal.
+func (p *Protocol) callMethod(ctx context.Context, msg *RpcMessage) (any, error) {
+	return Recoverer(p.invoke)(ctx, msg)
+}
+
+// invoke calls the method of the message on the caller.
+func (p *Protocol) invoke(ctx context.Context, msg *RpcMessage) (any, error) {
+	if msg.NamedParams != nil {
+		return p.caller.CallNamedMethod(ctx, msg.Method, msg.NamedParams)
+	}
+	return p.caller.CallMethod(ctx, msg.Method, msg.Params)
+}
+
 func (p *Protocol) handleResult(msg *RpcMessage) {
 	call, ok := p.takePending(msg.Id)
 	if !ok {
-		log.Printf("rpc: unknown result id: %d", msg.Id)
+		log.Printf("rpc: unknown result id: %s", msg.Id)
 		return
 	}
 	call.Done <- msg
 }
 
 func (p *Protocol) handleError(msg *RpcMessage) {
-	if msg.Id != 0 {
+	if !msg.Id.IsNull() {
 		call, ok := p.takePending(msg.Id)
 		if ok {
 			call.Done <- msg
@@ -110,27 +416,113 @@ func (p *Protocol) SendMessage(msg *RpcMessage) error {
 	return p.sender.SendMessage(msg)
 }
 
-func (p *Protocol) callWithId(id uint64, method string, params []any) (any, error) {
-	msg := MakeCall(id, method, params)
-	call := NewPendingCall(msg)
+func (p *Protocol) SendBatch(msgs []*RpcMessage) error {
+	return p.sender.SendBatch(msgs)
+}
+
+// sendContext sends the message unless the context is done first.
+func (p *Protocol) sendContext(ctx context.Context, msg *RpcMessage) error {
+	if s, ok := p.sender.(contextSender); ok {
+		return s.sendMessageContext(ctx, msg)
+	}
+	return p.sender.SendMessage(msg)
+}
+
+// sendBatchContext sends the batch unless the context is done first.
+func (p *Protocol) sendBatchContext(ctx context.Context, msgs []*RpcMessage) error {
+	if s, ok := p.sender.(contextSender); ok {
+		return s.sendBatchContext(ctx, msgs)
+	}
+	return p.sender.SendBatch(msgs)
+}
+
+// trySend sends the message unless that would block.
+func (p *Protocol) trySend(msg *RpcMessage) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return p.sendContext(ctx, msg)
+}
+
+func (p *Protocol) callWithId(id Id, method string, params []any) (any, error) {
+	return p.call(context.Background(), MakeCall(id, method, params))
+}
+
+// UseOutbound appends middlewares run around every call sent. The first
+// middleware is the outermost.
+func (p *Protocol) UseOutbound(middlewares ...Middleware) {
 	p.mutex.Lock()
-	p.pending[msg.Id] = call
+	defer p.mutex.Unlock()
+	p.middlewares = append(p.middlewares, middlewares...)
+	p.outbound = chain(p.roundTrip, p.middlewares)
+}
+
+// call runs the call message through the outbound middlewares, sends it
+// and blocks until it is answered.
+func (p *Protocol) call(ctx context.Context, msg *RpcMessage) (any, error) {
+	p.mutex.Lock()
+	handler := p.outbound
 	p.mutex.Unlock()
-	err := p.SendMessage(msg)
+	if handler == nil {
+		handler = p.roundTrip
+	}
+	return handler(ctx, msg)
+}
+
+// roundTrip sends the call message and blocks until it is answered.
+func (p *Protocol) roundTrip(ctx context.Context, msg *RpcMessage) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	call := NewPendingCall(msg)
+	err := p.addPending(call)
 	if err != nil {
 		return nil, err
 	}
-	// block until call is done
-	result := <-call.Done
-	close(call.Done)
-	if result.Error != nil {
-		return nil, fmt.Errorf("jsonrpc error: %d: %s", result.Error.Code, result.Error.Message)
+	err = p.sendContext(ctx, msg)
+	if err != nil {
+		p.takePending(msg.Id)
+		return nil, err
 	}
-	return result.Result, nil
+	return p.wait(ctx, call)
+}
+
+// wait blocks until the call is answered, failed or the context is done.
+// A call abandoned by the context is no longer pending and the peer is
+// asked to cancel it.
+func (p *Protocol) wait(ctx context.Context, call *PendingCall) (any, error) {
+	select {
+	case reply := <-call.Done:
+		return call.result(reply)
+	case <-ctx.Done():
+		if _, ok := p.takePending(call.Message.Id); ok {
+			// the caller is done waiting, so is the cancel request
+			p.trySend(MakeNamedNotify(CancelRequestMethod, map[string]any{"id": call.Message.Id}))
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// replyResult converts a reply into the result or error of a call.
+// Errors are returned as *RpcError.
+func replyResult(msg *RpcMessage) (any, error) {
+	if msg.Error != nil {
+		return nil, msg.Error
+	}
+	return msg.Result, nil
 }
 
 func (p *Protocol) SendCall(method string, params []any) (any, error) {
-	return p.callWithId(p.nextSeq(), method, params)
+	return p.callWithId(NumberId(p.nextSeq()), method, params)
+}
+
+// CallContext sends a call and waits for the result until the context is done.
+func (p *Protocol) CallContext(ctx context.Context, method string, params []any) (any, error) {
+	return p.call(ctx, MakeCall(NumberId(p.nextSeq()), method, params))
+}
+
+// SendNamedCall sends a call with params passed by name and waits for the result.
+func (p *Protocol) SendNamedCall(method string, params map[string]any) (any, error) {
+	return p.call(context.Background(), MakeNamedCall(NumberId(p.nextSeq()), method, params))
 }
 
 func (p *Protocol) SendNotify(method string, params []any) error {
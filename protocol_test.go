@@ -1,8 +1,11 @@
 package jsonrpc
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -23,8 +26,8 @@ func TestFailingHandleNotify(t *testing.T) {
 	p := NewProtocol(s, r)
 	msg := MakeNotify("test", []any{1, 2, 3})
 	p.handleMessage(msg)
-	assert.Equal(t, 1, len(s.Messages))
-	assert.Equal(t, ErrorCodeMethodNotFound, s.Messages[0].Error.Code)
+	// notifications are never answered
+	assert.Equal(t, 0, len(s.Messages))
 }
 
 // test protocol call
@@ -34,7 +37,7 @@ func TestProtocolCall(t *testing.T) {
 	p := NewProtocol(s, r)
 	wg := sync.WaitGroup{}
 	wg.Add(1)
-	id := p.nextSeq()
+	id := NumberId(p.nextSeq())
 	go func() {
 		// send a result message
 		// TODO: difficult to test as we don't know the id
@@ -45,7 +48,7 @@ func TestProtocolCall(t *testing.T) {
 	// Call will block. We need to wait for the call to be handled.
 	result, err := p.callWithId(id, "test", []any{1, 2, 3})
 	assert.Equal(t, len(s.Messages), 1)
-	assert.Equal(t, s.Messages[0].Id, uint64(1))
+	assert.Equal(t, s.Messages[0].Id, NumberId(1))
 	assert.Equal(t, s.Messages[0].Method, "test")
 	wg.Wait()
 	assert.Nil(t, err)
@@ -91,7 +94,7 @@ func TestHandleCallError(t *testing.T) {
 	s := NewMockMessageSender()
 	p := NewProtocol(s, r)
 	msg := MakeError(ErrorCodeInternal, "test", []any{1, 2, 3})
-	msg.Id = 1
+	msg.Id = NumberId(1)
 	p.handleMessage(msg)
 	assert.Equal(t, len(s.Messages), 0)
 }
@@ -106,11 +109,11 @@ func TestHandleCall(t *testing.T) {
 	})
 	s := NewMockMessageSender()
 	p := NewProtocol(s, r)
-	msg := MakeCall(1, "test", []any{1, 2, 3})
+	msg := MakeCall(NumberId(1), "test", []any{1, 2, 3})
 	p.handleMessage(msg)
 	assert.True(t, isCalled)
 	assert.Equal(t, len(s.Messages), 1)
-	assert.Equal(t, s.Messages[0].Id, uint64(1))
+	assert.Equal(t, s.Messages[0].Id, NumberId(1))
 	assert.Equal(t, s.Messages[0].Result, "test")
 }
 
@@ -119,7 +122,141 @@ func TestHandleResult(t *testing.T) {
 	r := NewRegistry()
 	s := NewMockMessageSender()
 	p := NewProtocol(s, r)
-	msg := MakeResult(1, "test")
+	msg := MakeResult(NumberId(1), "test")
 	p.handleMessage(msg)
 	assert.Equal(t, len(s.Messages), 0)
 }
+
+// test call with context timeout
+func TestCallContextTimeout(t *testing.T) {
+	r := NewRegistry()
+	s := NewMockMessageSender()
+	p := NewProtocol(s, r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := p.CallContext(ctx, "test", []any{1, 2, 3})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, "test", s.Messages[0].Method)
+	assert.Equal(t, 0, len(p.pending))
+	// a late result is ignored
+	p.handleMessage(MakeResult(s.Messages[0].Id, "test"))
+}
+
+// test call with cancelled context
+func TestCallContextCancel(t *testing.T) {
+	r := NewRegistry()
+	s := NewMockMessageSender()
+	p := NewProtocol(s, r)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := p.CallContext(ctx, "test", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, len(s.Messages))
+}
+
+// test pending calls fail when the connection closes
+func TestFailPending(t *testing.T) {
+	r := NewRegistry()
+	s := NewMockMessageSender()
+	p := NewProtocol(s, r)
+	done := make(chan error)
+	go func() {
+		_, err := p.CallContext(context.Background(), "test", nil)
+		done <- err
+	}()
+	assert.Eventually(t, func() bool {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		return len(p.pending) == 1
+	}, time.Second, time.Millisecond)
+	p.failPending(ErrConnectionClosed)
+	assert.ErrorIs(t, <-done, ErrConnectionClosed)
+	_, err := p.SendCall("test", nil)
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+}
+
+// test abandoned call sends a cancel request
+func TestCallContextSendsCancel(t *testing.T) {
+	r := NewRegistry()
+	s := NewMockMessageSender()
+	p := NewProtocol(s, r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := p.CallContext(ctx, "test", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 2, len(s.Messages))
+	assert.Equal(t, CancelRequestMethod, s.Messages[1].Method)
+	assert.True(t, s.Messages[1].IsNotify())
+	assert.Equal(t, s.Messages[0].Id, s.Messages[1].NamedParams["id"])
+}
+
+// test cancel request cancels the handler
+func TestHandleCancel(t *testing.T) {
+	r := NewRegistry()
+	started := make(chan bool)
+	r.Register("wait", func(ctx context.Context) error {
+		started <- true
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s := NewMockMessageSender()
+	p := NewProtocol(s, r)
+	done := make(chan *RpcMessage)
+	go func() {
+		done <- p.handleCall(MakeCall(StringId("a"), "wait", nil))
+	}()
+	<-started
+	p.handleData([]byte(`{"jsonrpc": "2.0", "method": "$/cancelRequest", "params": {"id": "a"}}`))
+	reply := <-done
+	assert.Equal(t, StringId("a"), reply.Id)
+	assert.Equal(t, ErrorCodeRequestCancelled, reply.Error.Code)
+	assert.Equal(t, 0, len(s.Messages))
+	assert.Equal(t, 0, len(p.inflight))
+}
+
+// test handle call error codes
+func TestHandleCallErrorCodes(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterMethod("fail", func(params []any) (any, error) {
+		return nil, errors.New("failure")
+	})
+	r.RegisterMethod("panic", func(params []any) (any, error) {
+		panic("boom")
+	})
+	r.Register("add", func(a, b int) (int, error) {
+		return a + b, nil
+	})
+	tests := []struct {
+		method string
+		params []any
+		code   ErrorCode
+	}{
+		{"missing", nil, ErrorCodeMethodNotFound},
+		{"fail", nil, ErrorCodeInternal},
+		{"panic", nil, ErrorCodeInternal},
+		{"add", []any{1, "two"}, ErrorCodeInvalidParams},
+	}
+	for i, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			s := NewMockMessageSender()
+			p := NewProtocol(s, r)
+			id := NumberId(uint64(i + 1))
+			p.handleMessage(MakeCall(id, tt.method, tt.params))
+			assert.Equal(t, 1, len(s.Messages))
+			assert.Equal(t, id, s.Messages[0].Id)
+			assert.Equal(t, tt.code, s.Messages[0].Error.Code)
+		})
+	}
+}
+
+// test panicking notification is not answered
+func TestHandleNotifyPanic(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterMethod("panic", func(params []any) (any, error) {
+		panic("boom")
+	})
+	s := NewMockMessageSender()
+	p := NewProtocol(s, r)
+	p.handleMessage(MakeNotify("panic", nil))
+	assert.Equal(t, 0, len(s.Messages))
+}
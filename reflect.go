@@ -0,0 +1,122 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// funcHandler calls an ordinary Go function with params decoded into
+// the types of its arguments.
+type funcHandler struct {
+	fn        reflect.Value
+	name      string
+	args      []reflect.Type
+	hasCtx    bool
+	hasResult bool
+}
+
+// newFuncHandler checks the signature of fn. The function takes an optional
+// context.Context followed by any number of arguments and returns either
+// a result and an error or just an error.
+func newFuncHandler(fn any) (*funcHandler, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("jsonrpc: %T is not a function", fn)
+	}
+	t := v.Type()
+	h := &funcHandler{
+		fn:   v,
+		name: t.String(),
+	}
+	if t.IsVariadic() {
+		return nil, fmt.Errorf("jsonrpc: %s: variadic functions are not supported", h.name)
+	}
+	for i := 0; i < t.NumIn(); i++ {
+		arg := t.In(i)
+		if i == 0 && arg == contextType {
+			h.hasCtx = true
+			continue
+		}
+		h.args = append(h.args, arg)
+	}
+	switch {
+	case t.NumOut() == 1 && t.Out(0) == errorType:
+	case t.NumOut() == 2 && t.Out(1) == errorType:
+		h.hasResult = true
+	default:
+		return nil, fmt.Errorf("jsonrpc: %s: must return (result, error) or error", h.name)
+	}
+	return h, nil
+}
+
+// call decodes params passed by position into the arguments and calls the function.
+func (h *funcHandler) call(ctx context.Context, params []any) (any, error) {
+	if len(params) != len(h.args) {
+		return nil, fmt.Errorf("%w: expected %d params, got %d", ErrInvalidParams, len(h.args), len(params))
+	}
+	in := make([]reflect.Value, 0, len(params)+1)
+	if h.hasCtx {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	for i, param := range params {
+		v, err := decodeArg(param, h.args[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: argument %d: %v", ErrInvalidParams, i, err)
+		}
+		in = append(in, v)
+	}
+	return h.invoke(in)
+}
+
+// callNamed decodes params passed by name into the single argument of
+// the function and calls it.
+func (h *funcHandler) callNamed(ctx context.Context, params map[string]any) (any, error) {
+	if len(h.args) != 1 {
+		return nil, fmt.Errorf("%w: expects params by position", ErrInvalidParams)
+	}
+	return h.call(ctx, []any{params})
+}
+
+// method adapts the function to the handles of a registered method.
+func (h *funcHandler) method() method {
+	m := method{
+		call: h.call,
+	}
+	if len(h.args) == 1 {
+		m.callNamed = h.callNamed
+	}
+	return m
+}
+
+func (h *funcHandler) invoke(in []reflect.Value) (any, error) {
+	out := h.fn.Call(in)
+	errValue := out[len(out)-1]
+	if !errValue.IsNil() {
+		return nil, errValue.Interface().(error)
+	}
+	if !h.hasResult {
+		return nil, nil
+	}
+	return out[0].Interface(), nil
+}
+
+// decodeArg converts a decoded JSON value into a value of the given type.
+func decodeArg(param any, t reflect.Type) (reflect.Value, error) {
+	data, err := json.Marshal(param)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	v := reflect.New(t)
+	err = json.Unmarshal(data, v.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
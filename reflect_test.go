@@ -0,0 +1,155 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type addRequest struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+type addResponse struct {
+	Sum int `json:"sum"`
+}
+
+// test register typed function
+func TestRegisterFunc(t *testing.T) {
+	registry := NewRegistry()
+	err := registry.Register("add", func(ctx context.Context, a, b int) (int, error) {
+		assert.NotNil(t, ctx)
+		return a + b, nil
+	})
+	assert.NoError(t, err)
+	result, err := registry.CallMethod(context.Background(), "add", []any{1.0, 2.0})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result)
+
+	_, err = registry.CallMethod(context.Background(), "add", []any{1.0, "two"})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+	assert.Contains(t, err.Error(), "argument 1")
+
+	_, err = registry.CallMethod(context.Background(), "add", []any{1.0})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+
+	_, err = registry.CallNamedMethod(context.Background(), "add", map[string]any{"a": 1.0})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+}
+
+// test register typed function with request struct
+func TestRegisterFuncStruct(t *testing.T) {
+	registry := NewRegistry()
+	err := registry.Register("add", func(ctx context.Context, req addRequest) (addResponse, error) {
+		return addResponse{Sum: req.A + req.B}, nil
+	})
+	assert.NoError(t, err)
+	result, err := registry.CallNamedMethod(context.Background(), "add", map[string]any{"a": 1.0, "b": 2.0})
+	assert.NoError(t, err)
+	assert.Equal(t, addResponse{Sum: 3}, result)
+
+	result, err = registry.CallMethod(context.Background(), "add", []any{map[string]any{"a": 2.0, "b": 2.0}})
+	assert.NoError(t, err)
+	assert.Equal(t, addResponse{Sum: 4}, result)
+
+	_, err = registry.CallNamedMethod(context.Background(), "add", map[string]any{"a": "one"})
+	assert.ErrorIs(t, err, ErrInvalidParams)
+}
+
+// test register function without context and result
+func TestRegisterFuncError(t *testing.T) {
+	registry := NewRegistry()
+	failure := errors.New("failure")
+	err := registry.Register("fail", func(reason string) error {
+		return failure
+	})
+	assert.NoError(t, err)
+	_, err = registry.CallMethod(context.Background(), "fail", []any{"test"})
+	assert.ErrorIs(t, err, failure)
+
+	err = registry.Register("ok", func() error {
+		return nil
+	})
+	assert.NoError(t, err)
+	result, err := registry.CallMethod(context.Background(), "ok", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+// test register invalid functions
+func TestRegisterInvalidFunc(t *testing.T) {
+	registry := NewRegistry()
+	assert.Error(t, registry.Register("test", "test"))
+	assert.Error(t, registry.Register("test", func() int { return 0 }))
+	assert.Error(t, registry.Register("test", func(args ...int) error { return nil }))
+	assert.Nil(t, registry.GetMethod("test"))
+}
+
+type testCalc struct {
+	Total int
+}
+
+func (c *testCalc) Add(ctx context.Context, value int) (int, error) {
+	c.Total += value
+	return c.Total, nil
+}
+
+func (c *testCalc) GetTotal() (int, error) {
+	return c.Total, nil
+}
+
+func (c *testCalc) String() string {
+	return "calc"
+}
+
+// test register service
+func TestRegisterService(t *testing.T) {
+	registry := NewRegistry()
+	calc := &testCalc{}
+	err := registry.RegisterService("calc", calc)
+	assert.NoError(t, err)
+	result, err := registry.CallMethod(context.Background(), "calc.add", []any{2.0})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result)
+	result, err = registry.CallMethod(context.Background(), "calc.getTotal", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result)
+	assert.Nil(t, registry.GetMethod("calc.string"))
+
+	registry.RegisterMethod("other.add", func(params []any) (any, error) {
+		return nil, nil
+	})
+	registry.UnregisterService("calc")
+	assert.Nil(t, registry.GetMethod("calc.add"))
+	assert.Nil(t, registry.GetMethod("calc.getTotal"))
+	assert.NotNil(t, registry.GetMethod("other.add"))
+
+	registry.SetNamingConvention(SnakeCase)
+	err = registry.RegisterService("calc", calc)
+	assert.NoError(t, err)
+	assert.NotNil(t, registry.GetMethod("calc.get_total"))
+
+	assert.Error(t, registry.RegisterService("calc", testCalc{}))
+	assert.Error(t, registry.RegisterService("calc", nil))
+}
+
+func TestNamingConvention(t *testing.T) {
+	tests := []struct {
+		name  string
+		camel string
+		snake string
+	}{
+		{"Add", "add", "add"},
+		{"GetTotal", "getTotal", "get_total"},
+		{"HTTPStatus", "httpStatus", "http_status"},
+		{"ID", "id", "id"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.camel, LowerCamelCase(tt.name))
+		assert.Equal(t, tt.snake, SnakeCase(tt.name))
+		assert.Equal(t, tt.name, ExactCase(tt.name))
+	}
+}
@@ -7,6 +7,7 @@ import (
 // mock message sender
 type MockMessageSender struct {
 	Messages []*RpcMessage
+	Batches  [][]*RpcMessage
 	mutex    sync.Mutex
 }
 
@@ -22,3 +23,10 @@ func (m *MockMessageSender) SendMessage(msg *RpcMessage) error {
 	m.mutex.Unlock()
 	return nil
 }
+
+func (m *MockMessageSender) SendBatch(msgs []*RpcMessage) error {
+	m.mutex.Lock()
+	m.Batches = append(m.Batches, msgs)
+	m.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,218 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Examples from https://www.jsonrpc.org/specification#examples
+
+func makeSpecProtocol() (*Protocol, *MockMessageSender) {
+	r := NewRegistry()
+	r.RegisterMethod("subtract", func(params []any) (any, error) {
+		return params[0].(float64) - params[1].(float64), nil
+	})
+	r.RegisterNamedMethod("subtract", func(params map[string]any) (any, error) {
+		return params["minuend"].(float64) - params["subtrahend"].(float64), nil
+	})
+	r.RegisterMethod("update", func(params []any) (any, error) {
+		return nil, nil
+	})
+	r.RegisterMethod("sum", func(params []any) (any, error) {
+		sum := 0.0
+		for _, p := range params {
+			sum += p.(float64)
+		}
+		return sum, nil
+	})
+	r.RegisterMethod("notify_hello", func(params []any) (any, error) {
+		return nil, nil
+	})
+	r.RegisterMethod("get_data", func(params []any) (any, error) {
+		return []any{"hello", 5}, nil
+	})
+	s := NewMockMessageSender()
+	return NewProtocol(s, r), s
+}
+
+// normalizeReply decodes a reply and drops the free-form error message and data.
+func normalizeReply(t *testing.T, data []byte) map[string]any {
+	reply := map[string]any{}
+	assert.NoError(t, json.Unmarshal(data, &reply))
+	if e, ok := reply["error"].(map[string]any); ok {
+		delete(e, "message")
+		delete(e, "data")
+	}
+	return reply
+}
+
+func assertReplies(t *testing.T, expected []string, actual []*RpcMessage) {
+	assert.Equal(t, len(expected), len(actual))
+	for i := range expected {
+		if i >= len(actual) {
+			break
+		}
+		data, err := json.Marshal(actual[i])
+		assert.NoError(t, err)
+		assert.Equal(t, normalizeReply(t, []byte(expected[i])), normalizeReply(t, data))
+	}
+}
+
+func TestSpecExamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		replies []string
+	}{
+		{
+			"positional parameters",
+			`{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": 1}`,
+			[]string{`{"jsonrpc": "2.0", "result": 19, "id": 1}`},
+		},
+		{
+			"positional parameters reversed",
+			`{"jsonrpc": "2.0", "method": "subtract", "params": [23, 42], "id": 2}`,
+			[]string{`{"jsonrpc": "2.0", "result": -19, "id": 2}`},
+		},
+		{
+			"named parameters",
+			`{"jsonrpc": "2.0", "method": "subtract", "params": {"subtrahend": 23, "minuend": 42}, "id": 3}`,
+			[]string{`{"jsonrpc": "2.0", "result": 19, "id": 3}`},
+		},
+		{
+			"named parameters reordered",
+			`{"jsonrpc": "2.0", "method": "subtract", "params": {"minuend": 42, "subtrahend": 23}, "id": 4}`,
+			[]string{`{"jsonrpc": "2.0", "result": 19, "id": 4}`},
+		},
+		{
+			"named parameters not accepted",
+			`{"jsonrpc": "2.0", "method": "sum", "params": {"a": 1}, "id": 5}`,
+			[]string{`{"jsonrpc": "2.0", "error": {"code": -32602, "message": "Invalid params"}, "id": 5}`},
+		},
+		{
+			"notification",
+			`{"jsonrpc": "2.0", "method": "update", "params": [1,2,3,4,5]}`,
+			[]string{},
+		},
+		{
+			"notification without params",
+			`{"jsonrpc": "2.0", "method": "foobar"}`,
+			[]string{},
+		},
+		{
+			"non-existent method",
+			`{"jsonrpc": "2.0", "method": "foobar", "id": "1"}`,
+			[]string{`{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "1"}`},
+		},
+		{
+			"invalid JSON",
+			`{"jsonrpc": "2.0", "method": "foobar, "params": "bar", "baz]`,
+			[]string{`{"jsonrpc": "2.0", "error": {"code": -32700, "message": "Parse error"}, "id": null}`},
+		},
+		{
+			"invalid request object",
+			`{"jsonrpc": "2.0", "method": 1, "params": "bar"}`,
+			[]string{`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`},
+		},
+		{
+			"wrong version",
+			`{"jsonrpc": "1.0", "method": "subtract", "params": [42, 23], "id": 3}`,
+			[]string{`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": 3}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, s := makeSpecProtocol()
+			p.handleData([]byte(tt.request))
+			assertReplies(t, tt.replies, s.Messages)
+		})
+	}
+}
+
+func TestSpecBatchExamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		replies []string
+		batch   []string
+	}{
+		{
+			"batch",
+			`[
+				{"jsonrpc": "2.0", "method": "sum", "params": [1,2,4], "id": "1"},
+				{"jsonrpc": "2.0", "method": "notify_hello", "params": [7]},
+				{"jsonrpc": "2.0", "method": "subtract", "params": [42,23], "id": "2"},
+				{"foo": "boo"},
+				{"jsonrpc": "2.0", "method": "foo.get", "params": {"name": "myself"}, "id": "5"},
+				{"jsonrpc": "2.0", "method": "get_data", "id": "9"}
+			]`,
+			[]string{},
+			[]string{
+				`{"jsonrpc": "2.0", "result": 7, "id": "1"}`,
+				`{"jsonrpc": "2.0", "result": 19, "id": "2"}`,
+				`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`,
+				`{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Method not found"}, "id": "5"}`,
+				`{"jsonrpc": "2.0", "result": ["hello", 5], "id": "9"}`,
+			},
+		},
+		{
+			"invalid JSON batch",
+			`[
+				{"jsonrpc": "2.0", "method": "sum", "params": [1,2,4], "id": "1"},
+				{"jsonrpc": "2.0", "method"
+			]`,
+			[]string{`{"jsonrpc": "2.0", "error": {"code": -32700, "message": "Parse error"}, "id": null}`},
+			nil,
+		},
+		{
+			"empty batch",
+			`[]`,
+			[]string{`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`},
+			nil,
+		},
+		{
+			"invalid batch",
+			`[1]`,
+			[]string{},
+			[]string{
+				`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`,
+			},
+		},
+		{
+			"invalid batches",
+			`[1,2,3]`,
+			[]string{},
+			[]string{
+				`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`,
+				`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`,
+				`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "Invalid Request"}, "id": null}`,
+			},
+		},
+		{
+			"notification batch",
+			`[
+				{"jsonrpc": "2.0", "method": "notify_sum", "params": [1,2,4]},
+				{"jsonrpc": "2.0", "method": "notify_hello", "params": [7]}
+			]`,
+			[]string{},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, s := makeSpecProtocol()
+			p.handleData([]byte(tt.request))
+			assertReplies(t, tt.replies, s.Messages)
+			if tt.batch == nil {
+				assert.Equal(t, 0, len(s.Batches))
+				return
+			}
+			assert.Equal(t, 1, len(s.Batches))
+			if len(s.Batches) == 1 {
+				assertReplies(t, tt.batch, s.Batches[0])
+			}
+		})
+	}
+}
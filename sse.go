@@ -0,0 +1,208 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrReceiveOnly is returned when sending a request over an event source.
+var ErrReceiveOnly = errors.New("jsonrpc: event source cannot send requests, use HTTPClient")
+
+// sseTransport streams messages as server-sent events. It never reads.
+type sseTransport struct {
+	w       io.Writer
+	flusher http.Flusher
+	// deadline sets the write deadline of the response, nil if the
+	// response writer does not support it
+	deadline func(time.Time) error
+	timeout  time.Duration
+	mutex    sync.Mutex
+	closed   bool
+	done     chan struct{}
+}
+
+func newSSETransport(w http.ResponseWriter, flusher http.Flusher, opts ConnectionOptions) *sseTransport {
+	t := &sseTransport{
+		w:        w,
+		flusher:  flusher,
+		deadline: writeDeadline(w),
+		timeout:  opts.WriteTimeout,
+		done:     make(chan struct{}),
+	}
+	go t.keepAlive(opts.PingInterval)
+	return t
+}
+
+// writeDeadline returns the SetWriteDeadline method of the response writer
+// or of a writer it wraps.
+func writeDeadline(w http.ResponseWriter) func(time.Time) error {
+	for {
+		switch v := w.(type) {
+		case interface{ SetWriteDeadline(time.Time) error }:
+			return v.SetWriteDeadline
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+func (t *sseTransport) ReadMessage() ([]byte, error) {
+	<-t.done
+	return nil, io.EOF
+}
+
+func (t *sseTransport) WriteMessage(data []byte) error {
+	return t.write("data: %s\n\n", data)
+}
+
+func (t *sseTransport) write(format string, args ...any) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return io.ErrClosedPipe
+	}
+	if t.deadline != nil {
+		t.deadline(time.Now().Add(t.timeout))
+	}
+	_, err := fmt.Fprintf(t.w, format, args...)
+	if err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+func (t *sseTransport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.done)
+	}
+	return nil
+}
+
+// keepAlive sends comments to keep proxies from closing an idle stream.
+func (t *sseTransport) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			if t.write(": ping\n\n") != nil {
+				return
+			}
+		}
+	}
+}
+
+// HandleEvents streams the notifications broadcast by the hub to the
+// client as server-sent events, one message per event. Clients make
+// calls with HandlePost. Subscribers not taking an event within the write
+// timeout are closed.
+func (h *Hub) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	t := newSSETransport(w, flusher, h.opts.ConnectionOptions)
+	c := newConnection(requestContext(r), t, JSONCodec, &h.Methods, h, h.dispatch, h.opts.ConnectionOptions)
+	h.AddConnection(c)
+	// the client is subscribed once it sees the headers
+	t.write(": connected\n\n")
+	select {
+	case <-r.Context().Done():
+		c.Close()
+	case <-t.done:
+	}
+	// the response must not be written once the handler returns
+	t.Close()
+}
+
+// eventSource reads messages from a stream of server-sent events.
+type eventSource struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+}
+
+// NewEventSource subscribes to the events served by HandleEvents at url
+// and returns them as receive only transport, e.g. to handle the
+// notifications with NewTransportClient. Replies to calls of the server are
+// dropped. Sending a request ends the subscription and the call fails with
+// ErrConnectionClosed, calls are made with HTTPClient.
+func NewEventSource(url string) (Transport, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("jsonrpc: http status %s", resp.Status)
+	}
+	return &eventSource{body: resp.Body, reader: bufio.NewReader(resp.Body)}, nil
+}
+
+// ReadMessage returns the data of the next event.
+func (s *eventSource) ReadMessage() ([]byte, error) {
+	var data []byte
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, io.EOF
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case len(line) == 0 && data != nil:
+			return data, nil
+		case bytes.HasPrefix(line, []byte("data:")):
+			if data != nil {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(line[5:], []byte(" "))...)
+		}
+	}
+}
+
+// WriteMessage drops replies, failing them would end the subscription.
+// Calls and notifications cannot be sent and fail with ErrReceiveOnly.
+func (s *eventSource) WriteMessage(data []byte) error {
+	var msgs []struct {
+		Method string `json:"method"`
+	}
+	if !isBatch(data) {
+		data = append(append([]byte{'['}, data...), ']')
+	}
+	if json.Unmarshal(data, &msgs) != nil {
+		return nil
+	}
+	for _, msg := range msgs {
+		if msg.Method != "" {
+			return ErrReceiveOnly
+		}
+	}
+	return nil
+}
+
+func (s *eventSource) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,125 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleEvents(t *testing.T) {
+	hub := NewHub()
+	handler := NewRouter()
+	handler.Get("/events", hub.HandleEvents)
+	handler.Post("/rpc", hub.HandlePost)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	hub.RegisterMethod("publish", func(params []any) (any, error) {
+		hub.Notify("news", params)
+		return true, nil
+	})
+	events, err := NewEventSource(ts.URL + "/events")
+	assert.NoError(t, err)
+	subscriber := NewTransportClient(events)
+	received := make(chan any, 1)
+	subscriber.RegisterMethod("news", func(params []any) (any, error) {
+		received <- params[0]
+		return nil, nil
+	})
+
+	result, err := NewHTTPClient(ts.URL+"/rpc").Call("publish", []any{"hello"})
+	assert.NoError(t, err)
+	assert.Equal(t, true, result)
+	select {
+	case msg := <-received:
+		assert.Equal(t, "hello", msg)
+	case <-time.After(time.Second):
+		t.Fatal("notification not streamed")
+	}
+
+	// replies to calls are dropped without ending the subscription
+	hub.BroadcastMessage(MakeCall(NumberId(1), "news", []any{"call"}))
+	assert.Equal(t, "call", <-received)
+	_, err = NewHTTPClient(ts.URL+"/rpc").Call("publish", []any{"again"})
+	assert.NoError(t, err)
+	select {
+	case msg := <-received:
+		assert.Equal(t, "again", msg)
+	case <-time.After(time.Second):
+		t.Fatal("subscription ended by a reply")
+	}
+
+	// calls over the event source fail instead of hanging
+	_, err = subscriber.Call("publish", []any{"call"})
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+
+	subscriber.Close()
+	assert.Eventually(t, func() bool {
+		hub.Connections.mutex.Lock()
+		defer hub.Connections.mutex.Unlock()
+		return len(hub.connections) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestEventSourceReadMessage(t *testing.T) {
+	s := &eventSource{
+		body:   io.NopCloser(nil),
+		reader: bufio.NewReader(strings.NewReader(": ping\n\nevent: message\ndata: {\"a\":\ndata:1}\r\n\r\ndata: []\n\n")),
+	}
+	data, err := s.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"a\":\n1}", string(data))
+	data, err = s.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, "[]", string(data))
+	_, err = s.ReadMessage()
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, s.WriteMessage([]byte(`{"jsonrpc":"2.0","id":1,"result":true}`)))
+	assert.ErrorIs(t, s.WriteMessage([]byte(`{"jsonrpc":"2.0","method":"news"}`)), ErrReceiveOnly)
+	assert.ErrorIs(t, s.WriteMessage([]byte(`[{"jsonrpc":"2.0","id":1,"result":true},{"jsonrpc":"2.0","id":2,"method":"add"}]`)), ErrReceiveOnly)
+}
+
+func TestHandleEventsStalledSubscriber(t *testing.T) {
+	hub := NewHub(HubOptions{ConnectionOptions{WriteTimeout: 100 * time.Millisecond}})
+	handler := NewRouter()
+	handler.Get("/events", hub.HandleEvents)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	// the subscriber never reads
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /events HTTP/1.1\r\nHost: test\r\n\r\n"))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		hub.Connections.mutex.Lock()
+		defer hub.Connections.mutex.Unlock()
+		return len(hub.connections) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	payload := strings.Repeat("x", 1<<20)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 64; i++ {
+			hub.Notify("news", []any{payload})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("notify blocked by a stalled subscriber")
+	}
+	assert.Eventually(t, func() bool {
+		hub.Connections.mutex.Lock()
+		defer hub.Connections.mutex.Unlock()
+		return len(hub.connections) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
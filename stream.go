@@ -0,0 +1,167 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// streamTransport runs a connection over a byte stream.
+type streamTransport struct {
+	rwc    io.ReadWriteCloser
+	reader *bufio.Reader
+	mutex  sync.Mutex
+	closed int32
+	// limit is the largest message accepted in bytes
+	limit int64
+	read  func(r *bufio.Reader, limit int64) ([]byte, error)
+	frame func(data []byte) []byte
+}
+
+// NewFramedTransport returns a transport framing each message with
+// Content-Length headers like the Language Server Protocol. Messages
+// larger than the default read limit are rejected.
+func NewFramedTransport(rwc io.ReadWriteCloser) Transport {
+	return newFramedTransport(rwc, defaultReadLimit)
+}
+
+func newFramedTransport(rwc io.ReadWriteCloser, limit int64) Transport {
+	return &streamTransport{
+		rwc:    rwc,
+		reader: bufio.NewReader(rwc),
+		limit:  limit,
+		read:   readFramed,
+		frame: func(data []byte) []byte {
+			header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(data))
+			return append([]byte(header), data...)
+		},
+	}
+}
+
+// NewLineTransport returns a transport sending one message per line.
+// Lines longer than the default read limit are rejected.
+func NewLineTransport(rwc io.ReadWriteCloser) Transport {
+	return newLineTransport(rwc, defaultReadLimit)
+}
+
+func newLineTransport(rwc io.ReadWriteCloser, limit int64) Transport {
+	return &streamTransport{
+		rwc:    rwc,
+		reader: bufio.NewReader(rwc),
+		limit:  limit,
+		read:   readLine,
+		frame: func(data []byte) []byte {
+			return append(data, '\n')
+		},
+	}
+}
+
+func (t *streamTransport) ReadMessage() ([]byte, error) {
+	data, err := t.read(t.reader, t.limit)
+	if err != nil && atomic.LoadInt32(&t.closed) == 1 {
+		return nil, io.EOF
+	}
+	return data, err
+}
+
+func (t *streamTransport) WriteMessage(data []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	_, err := t.rwc.Write(t.frame(data))
+	return err
+}
+
+func (t *streamTransport) Close() error {
+	if !atomic.CompareAndSwapInt32(&t.closed, 0, 1) {
+		return nil
+	}
+	return t.rwc.Close()
+}
+
+// readFramed reads the headers up to an empty line and then the content,
+// which must not exceed limit bytes.
+func readFramed(r *bufio.Reader, limit int64) ([]byte, error) {
+	headers, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("jsonrpc: invalid header: %w", err)
+	}
+	value := headers.Get("Content-Length")
+	if value == "" {
+		return nil, fmt.Errorf("jsonrpc: missing Content-Length header")
+	}
+	length, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("jsonrpc: invalid Content-Length %q", value)
+	}
+	if length > limit {
+		return nil, fmt.Errorf("jsonrpc: message of %d bytes exceeds read limit of %d bytes", length, limit)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, length))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) < length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+// readLine reads the next non-empty line, which must not exceed limit
+// bytes without its line break.
+func readLine(r *bufio.Reader, limit int64) ([]byte, error) {
+	for {
+		var line []byte
+		var err error
+		for {
+			var chunk []byte
+			chunk, err = r.ReadSlice('\n')
+			line = append(line, chunk...)
+			if int64(len(line)) > limit+2 {
+				return nil, fmt.Errorf("jsonrpc: line exceeds read limit of %d bytes", limit)
+			}
+			if err != bufio.ErrBufferFull {
+				break
+			}
+		}
+		line = bytes.TrimSpace(line)
+		if int64(len(line)) > limit {
+			return nil, fmt.Errorf("jsonrpc: line exceeds read limit of %d bytes", limit)
+		}
+		if len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// stdio joins stdin and stdout of the process.
+type stdio struct {
+	io.Reader
+	io.Writer
+}
+
+// Stdio returns a stream reading stdin and writing stdout, e.g. to run
+// a connection with NewFramedTransport(Stdio()).
+func Stdio() io.ReadWriteCloser {
+	return stdio{os.Stdin, os.Stdout}
+}
+
+func (s stdio) Close() error {
+	err := os.Stdin.Close()
+	if err2 := os.Stdout.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// duplex joins the read end of one pipe with the write end of another.
+type duplex struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (d duplex) Close() error {
+	d.PipeReader.Close()
+	return d.PipeWriter.Close()
+}
+
+func makeStreams() (io.ReadWriteCloser, io.ReadWriteCloser) {
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+	return duplex{r1, w2}, duplex{r2, w1}
+}
+
+func testStreamCall(t *testing.T, newTransport func(io.ReadWriteCloser) Transport) {
+	a, b := makeStreams()
+	server := NewTransportClient(newTransport(a))
+	client := NewTransportClient(newTransport(b))
+	defer client.Close()
+	server.RegisterMethod("echo", func(params []any) (any, error) {
+		return params[0], nil
+	})
+	client.RegisterMethod("ping", func(params []any) (any, error) {
+		return "pong", nil
+	})
+	result, err := client.Call("echo", []any{"hello\nworld"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\nworld", result)
+	// both ends serve and call
+	result, err = server.Call("ping", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", result)
+}
+
+func TestFramedTransport(t *testing.T) {
+	testStreamCall(t, NewFramedTransport)
+}
+
+func TestLineTransport(t *testing.T) {
+	testStreamCall(t, NewLineTransport)
+}
+
+func TestReadFramed(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("Content-Length: 2\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n{}" +
+		"content-length: 4\r\n\r\nnull"))
+	data, err := readFramed(r, defaultReadLimit)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+	data, err = readFramed(r, defaultReadLimit)
+	assert.NoError(t, err)
+	assert.Equal(t, "null", string(data))
+	_, err = readFramed(r, defaultReadLimit)
+	assert.Equal(t, io.EOF, err)
+
+	_, err = readFramed(bufio.NewReader(strings.NewReader("Content-Type: text\r\n\r\n{}")), defaultReadLimit)
+	assert.ErrorContains(t, err, "missing Content-Length")
+	_, err = readFramed(bufio.NewReader(strings.NewReader("Content-Length: x\r\n\r\n{}")), defaultReadLimit)
+	assert.ErrorContains(t, err, "invalid Content-Length")
+	_, err = readFramed(bufio.NewReader(strings.NewReader("Content-Length: 4\r\n\r\n{}")), defaultReadLimit)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestReadFramedOversize(t *testing.T) {
+	_, err := readFramed(bufio.NewReader(strings.NewReader("Content-Length: 9223372036854775807\r\n\r\n{}")), defaultReadLimit)
+	assert.ErrorContains(t, err, "exceeds read limit of 1048576 bytes")
+	_, err = readFramed(bufio.NewReader(strings.NewReader("Content-Length: 5\r\n\r\nnull0")), 4)
+	assert.ErrorContains(t, err, "message of 5 bytes exceeds read limit of 4 bytes")
+
+	// the connection closes instead of crashing
+	a, b := makeStreams()
+	server := NewTransportClient(NewFramedTransport(a))
+	go b.Write([]byte("Content-Length: 9223372036854775807\r\n\r\n"))
+	select {
+	case <-server.Conn.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("connection not closed")
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("{\"a\":1}\r\n\n[1]"))
+	data, err := readLine(r, defaultReadLimit)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(data))
+	data, err = readLine(r, defaultReadLimit)
+	assert.NoError(t, err)
+	assert.Equal(t, `[1]`, string(data))
+	_, err = readLine(r, defaultReadLimit)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReadLineOversize(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("1234\r\n12345\n"))
+	data, err := readLine(r, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", string(data))
+	_, err = readLine(r, 4)
+	assert.ErrorContains(t, err, "line exceeds read limit of 4 bytes")
+
+	// lines longer than the reader buffer are bounded as well
+	r = bufio.NewReaderSize(strings.NewReader(strings.Repeat("x", 100)+"\n"), 16)
+	_, err = readLine(r, 64)
+	assert.ErrorContains(t, err, "line exceeds read limit of 64 bytes")
+}
@@ -0,0 +1,65 @@
+package jsonrpc
+
+import (
+	"io"
+	"sync"
+)
+
+// Transport carries the frames of a connection. Each message holds one
+// JSON-RPC message or batch. ReadMessage is called from one goroutine and
+// WriteMessage from another, Close may be called concurrently with both.
+type Transport interface {
+	// ReadMessage blocks until the next message arrives. It returns io.EOF
+	// once the transport is closed.
+	ReadMessage() ([]byte, error)
+	// WriteMessage sends one message.
+	WriteMessage(data []byte) error
+	// Close closes the transport and unblocks pending reads.
+	Close() error
+}
+
+// pipe connects two transports in memory.
+type pipe struct {
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type pipeTransport struct {
+	*pipe
+	in  <-chan []byte
+	out chan<- []byte
+}
+
+// NewPipe returns two transports connected in memory, what is written to
+// one is read from the other. Closing either end closes both.
+func NewPipe() (Transport, Transport) {
+	p := &pipe{done: make(chan struct{})}
+	a2b := make(chan []byte)
+	b2a := make(chan []byte)
+	return &pipeTransport{pipe: p, in: b2a, out: a2b}, &pipeTransport{pipe: p, in: a2b, out: b2a}
+}
+
+func (t *pipeTransport) ReadMessage() ([]byte, error) {
+	select {
+	case data := <-t.in:
+		return data, nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+func (t *pipeTransport) WriteMessage(data []byte) error {
+	select {
+	case t.out <- data:
+		return nil
+	case <-t.done:
+		return io.ErrClosedPipe
+	}
+}
+
+func (t *pipeTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.done)
+	})
+	return nil
+}
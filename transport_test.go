@@ -0,0 +1,59 @@
+package jsonrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makePipeClients() (*RpcClient, *RpcClient) {
+	a, b := NewPipe()
+	return NewTransportClient(a), NewTransportClient(b)
+}
+
+func TestPipeCall(t *testing.T) {
+	server, client := makePipeClients()
+	defer server.Close()
+	server.RegisterMethod("echo", func(params []any) (any, error) {
+		return params[0], nil
+	})
+	result, err := client.Call("echo", []any{"hello"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", result)
+
+	done := make(chan any, 1)
+	client.RegisterMethod("event", func(params []any) (any, error) {
+		done <- params[0]
+		return nil, nil
+	})
+	assert.NoError(t, server.Notify("event", []any{1}))
+	assert.Equal(t, float64(1), <-done)
+}
+
+func TestPipeCloseFailsPending(t *testing.T) {
+	server, client := makePipeClients()
+	release := make(chan struct{})
+	defer close(release)
+	server.RegisterMethod("block", func(params []any) (any, error) {
+		<-release
+		return nil, nil
+	})
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.Call("block", nil)
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	server.Close()
+	select {
+	case err := <-errs:
+		assert.ErrorIs(t, err, ErrConnectionClosed)
+	case <-time.After(time.Second):
+		t.Fatal("pending call not failed")
+	}
+	<-client.Conn.Context().Done()
+	_, err := client.CallContext(context.Background(), "block", nil)
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+}
@@ -0,0 +1,177 @@
+package jsonrpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrMessageTooBig is returned when a message exceeds the read limit.
+var ErrMessageTooBig = errors.New("jsonrpc: message exceeds read limit")
+
+// wsTransport runs a connection over a websocket. It keeps the websocket
+// alive with pings and closes it when the peer stops answering.
+type wsTransport struct {
+	conn        *websocket.Conn
+	messageType int
+	opts        ConnectionOptions
+	done        chan struct{}
+	closeOnce   sync.Once
+	// closeSent is set once a close message was sent
+	closeSent int32
+}
+
+// NewWebSocketTransport returns a transport sending text messages over conn.
+func NewWebSocketTransport(conn *websocket.Conn, opts ...ConnectionOptions) Transport {
+	return newWebSocketTransport(conn, false, connectionOptions(opts))
+}
+
+// newWebSocketTransport returns a transport sending binary or text messages.
+func newWebSocketTransport(conn *websocket.Conn, binary bool, opts ConnectionOptions) Transport {
+	t := &wsTransport{
+		conn:        conn,
+		messageType: websocket.TextMessage,
+		opts:        opts,
+		done:        make(chan struct{}),
+	}
+	if binary {
+		t.messageType = websocket.BinaryMessage
+	}
+	// the read limit is checked by ReadMessage to send a close reason
+	conn.SetReadLimit(0)
+	if opts.Compression {
+		if err := conn.SetCompressionLevel(opts.CompressionLevel); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+	conn.SetPongHandler(func(appData string) error {
+		return conn.SetReadDeadline(time.Now().Add(opts.PongTimeout))
+	})
+	go t.ping()
+	return t
+}
+
+func (t *wsTransport) ReadMessage() ([]byte, error) {
+	t.conn.SetReadDeadline(time.Now().Add(t.opts.PongTimeout))
+	_, r, err := t.conn.NextReader()
+	if err == nil {
+		var data []byte
+		data, err = io.ReadAll(io.LimitReader(r, t.opts.ReadLimit+1))
+		if err == nil && int64(len(data)) > t.opts.ReadLimit {
+			reason := fmt.Sprintf("message exceeds read limit of %d bytes", t.opts.ReadLimit)
+			log.Printf("error: %s", reason)
+			t.sendClose(websocket.CloseMessageTooBig, reason)
+			return nil, ErrMessageTooBig
+		}
+		if err == nil {
+			return data, nil
+		}
+	}
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+		log.Printf("error: %v", err)
+	}
+	return nil, io.EOF
+}
+
+func (t *wsTransport) WriteMessage(data []byte) error {
+	t.conn.SetWriteDeadline(time.Now().Add(t.opts.WriteTimeout))
+	// only used if compression was negotiated
+	t.conn.EnableWriteCompression(t.opts.Compression && len(data) >= t.opts.CompressionThreshold)
+	return t.conn.WriteMessage(t.messageType, data)
+}
+
+// sendClose sends a close message unless one was sent before.
+func (t *wsTransport) sendClose(code int, reason string) {
+	if !atomic.CompareAndSwapInt32(&t.closeSent, 0, 1) {
+		return
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	err := t.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(t.opts.WriteTimeout))
+	if err != nil && err != websocket.ErrCloseSent {
+		log.Printf("error: %v", err)
+	}
+}
+
+func (t *wsTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.sendClose(websocket.CloseNormalClosure, "")
+		err = t.conn.Close()
+	})
+	return err
+}
+
+// RemoteAddr returns the address of the peer.
+func (t *wsTransport) RemoteAddr() net.Addr {
+	return t.conn.RemoteAddr()
+}
+
+func (t *wsTransport) ping() {
+	ticker := time.NewTicker(t.opts.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			err := t.conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(t.opts.WriteTimeout))
+			if err != nil {
+				log.Printf("error: %v", err)
+				t.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// subprotocol returns the websocket subprotocol of the codec, e.g.
+// "jsonrpc2.msgpack".
+func subprotocol(codec Codec) string {
+	return "jsonrpc2." + codec.Name()
+}
+
+func codecForSubprotocol(codecs []Codec, name string) (Codec, bool) {
+	for _, codec := range codecs {
+		if subprotocol(codec) == name {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// DialWebSocket connects a client to the websocket at url with the options.
+// The codecs are requested as subprotocols in order of preference and the
+// one the server selects encodes the messages. Without codecs all codecs
+// are requested.
+func DialWebSocket(url string, opts ConnectionOptions, codecs ...Codec) (*RpcClient, error) {
+	if len(codecs) == 0 {
+		codecs = []Codec{JSONCodec, MsgpackCodec, CBORCodec}
+	}
+	subprotocols := make([]string, len(codecs))
+	for i, codec := range codecs {
+		subprotocols[i] = subprotocol(codec)
+	}
+	opts = opts.withDefaults()
+	conn, err := dialWebSocket(url, subprotocols, opts)
+	if err != nil {
+		return nil, err
+	}
+	codec, ok := codecForSubprotocol(codecs, conn.Subprotocol())
+	if !ok {
+		// servers without subprotocols speak JSON
+		codec, ok = codecForSubprotocol(codecs, subprotocol(JSONCodec))
+	}
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("jsonrpc: server selected no subprotocol of %v", subprotocols)
+	}
+	return NewCodecClient(conn, codec, opts), nil
+}